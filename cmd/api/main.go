@@ -9,10 +9,13 @@ import (
 	"time"
 
 	"github.com/AndreyChufelin/movies-api/internal/auth"
+	"github.com/AndreyChufelin/movies-api/internal/auth/fake"
 	"github.com/AndreyChufelin/movies-api/internal/config"
 	"github.com/AndreyChufelin/movies-api/internal/logger"
 	"github.com/AndreyChufelin/movies-api/internal/server/rest"
+	"github.com/AndreyChufelin/movies-api/internal/storage/memory"
 	"github.com/AndreyChufelin/movies-api/internal/storage/postgres"
+	"github.com/AndreyChufelin/movies-api/internal/worker"
 )
 
 func main() {
@@ -27,6 +30,9 @@ func main() {
 			"error", err,
 		)
 	}
+	for _, msg := range config.Deprecations() {
+		logg.Warn(msg)
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(),
 		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
@@ -34,42 +40,132 @@ func main() {
 	shutCtx, stop := context.WithTimeout(context.Background(), 10*time.Second)
 	defer stop()
 
-	logg.Info("connecting to database")
-	storage := postgres.NewStorage(
-		config.DB.Host,
-		config.DB.Port,
-		config.DB.User,
-		config.DB.Password,
-		config.DB.Name,
-	)
-	err = storage.Connect(ctx)
-	if err != nil {
-		logg.Fatal(
-			"falied to create connection with database",
-			"error", err,
+	var storage rest.Storage
+	switch config.Storage.Driver {
+	case "memory":
+		logg.Info("using in-memory storage")
+		storage = memory.NewStorage()
+	case "postgres", "":
+		logg.Info("connecting to database")
+		db := postgres.NewStorage(
+			config.DB.Host,
+			config.DB.Port,
+			config.DB.User,
+			config.DB.Password,
+			config.DB.Name,
+			postgres.Options{
+				MaxOpenConns:      config.DB.MaxOpenConns,
+				MaxIdleTime:       config.DB.MaxIdleTime,
+				SSLMode:           config.DB.SSLMode,
+				SSLRootCert:       config.DB.SSLRootCert,
+				StatementTimeout:  config.DB.StatementTimeout,
+				ApplicationName:   config.DB.ApplicationName,
+				HealthCheckPeriod: config.DB.HealthCheckPeriod,
+				ConnectRetries:    config.DB.ConnectRetries,
+				ConnectBackoff:    config.DB.ConnectBackoff,
+			},
 		)
+		err = db.Connect(ctx)
+		if err != nil {
+			logg.Fatal(
+				"falied to create connection with database",
+				"error", err,
+			)
+		}
+		defer db.Close(ctx)
+		storage = db
+	default:
+		logg.Fatal("unknown storage driver", "driver", config.Storage.Driver)
 	}
-	defer storage.Close(ctx)
 
-	auth := auth.NewAuth(logg, config.Auth.Host, config.Auth.Port)
-	err = auth.Start()
-	if err != nil {
-		logg.Fatal("failed to start auth")
+	switch config.Auth.DegradedMode {
+	case rest.AuthDegradedReject, rest.AuthDegradedAnonymous:
+	default:
+		logg.Fatal("unknown auth degraded mode", "mode", config.Auth.DegradedMode)
+	}
+
+	var authenticator rest.Authenticator
+	switch config.Auth.Mode {
+	case "grpc", "fake", "":
+		if config.Auth.CallTimeout <= 0 {
+			logg.Fatal("auth.call_timeout must be positive", "call_timeout", config.Auth.CallTimeout)
+		}
+		opts := auth.Options{
+			CacheSize:   config.Auth.CacheSize,
+			CacheTTL:    config.Auth.CacheTTL,
+			NegativeTTL: config.Auth.NegativeTTL,
+
+			CallTimeout:      config.Auth.CallTimeout,
+			MaxRetries:       config.Auth.MaxRetries,
+			RetryBackoff:     config.Auth.RetryBackoff,
+			BreakerThreshold: config.Auth.BreakerThreshold,
+			BreakerCooldown:  config.Auth.BreakerCooldown,
+
+			TLS: auth.TLSOptions{
+				Enabled:    config.Auth.TLS,
+				CAFile:     config.Auth.CAFile,
+				CertFile:   config.Auth.CertFile,
+				KeyFile:    config.Auth.KeyFile,
+				ServerName: config.Auth.ServerName,
+			},
+		}
+		if config.Auth.Mode == "fake" {
+			logg.Warn("verifying tokens with a fake movies-auth, do not use in production")
+			fakeAuth, err := startFakeAuth(config.Auth.Fixture)
+			if err != nil {
+				logg.Fatal("failed to start fake auth", "error", err)
+			}
+			defer fakeAuth.Close()
+			opts.TLS = auth.TLSOptions{}
+			opts.Dialer = fakeAuth.Dial
+		} else {
+			logg.Info("verifying tokens with movies-auth")
+		}
+		a := auth.NewAuth(logg, config.Auth.Host, config.Auth.Port, opts)
+		err = a.Start()
+		if err != nil {
+			logg.Fatal("failed to start auth")
+		}
+		defer a.Close()
+		authenticator = a
+	case "jwt":
+		logg.Info("verifying tokens as jwt")
+		v := auth.NewJWTVerifier(logg, auth.JWTOptions{
+			PublicKeyFile:   config.Auth.JWT.PublicKeyFile,
+			JWKSFile:        config.Auth.JWT.JWKSFile,
+			JWKSURL:         config.Auth.JWT.JWKSURL,
+			RefreshInterval: config.Auth.JWT.RefreshInterval,
+			Issuer:          config.Auth.JWT.Issuer,
+			Audience:        config.Auth.JWT.Audience,
+			ClockSkew:       config.Auth.JWT.ClockSkew,
+		})
+		err = v.Start()
+		if err != nil {
+			logg.Fatal("failed to start jwt verifier", "error", err)
+		}
+		defer v.Close()
+		authenticator = v
+	default:
+		logg.Fatal("unknown auth mode", "mode", config.Auth.Mode)
 	}
-	defer auth.Close()
 
 	restServer := rest.NewServer(
 		logg,
-		auth,
+		authenticator,
 		config.REST.Host,
 		config.REST.Port,
 		config.REST.IdleTimeout,
 		config.REST.ReadTimeout,
 		config.REST.WriteTimeout,
+		config.REST.QueryTimeout,
+		config.REST.RouteTimeouts,
 		storage,
 		config.RateLimiter.Limit,
 		config.RateLimiter.Enabled,
 		config.CORS.Origins,
+		config.REST.LegacyErrors,
+		config.Idempotency.TTL,
+		config.Auth.DegradedMode,
 	)
 	go func() {
 		err = restServer.Start()
@@ -86,10 +182,47 @@ func main() {
 		}
 	}()
 
+	go worker.Every(ctx, logg, "idempotency keys sweeper", config.Idempotency.SweepInterval,
+		func(ctx context.Context) error {
+			deleted, err := storage.DeleteExpiredIdempotencyKeys(ctx)
+			if err != nil {
+				return err
+			}
+			logg.Info("swept expired idempotency keys", "deleted", deleted)
+			return nil
+		},
+	)
+
+	if config.Trash.RetentionDays > 0 {
+		retention := time.Duration(config.Trash.RetentionDays) * 24 * time.Hour
+		go worker.Every(ctx, logg, "trash purger", config.Trash.SweepInterval,
+			func(ctx context.Context) error {
+				purged, err := storage.PurgeDeletedMovies(ctx, time.Now().Add(-retention))
+				if err != nil {
+					return err
+				}
+				logg.Info("purged deleted movies", "purged", purged)
+				return nil
+			},
+		)
+	}
+
 	<-ctx.Done()
 	logg.Info("stopping service")
 }
 
+func startFakeAuth(fixturePath string) (*fake.Server, error) {
+	fixture, err := fake.LoadFixture(fixturePath)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := fake.NewUserService(fixture)
+	if err != nil {
+		return nil, err
+	}
+	return fake.NewBufconn(svc), nil
+}
+
 func exitHandler() {
 	if e := recover(); e != nil {
 		if exit, ok := e.(logger.Exit); ok {
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/AndreyChufelin/movies-api/internal/auth/fake"
+	"github.com/AndreyChufelin/movies-api/internal/logger"
+)
+
+func main() {
+	logg := &logger.Logger{
+		Logger: slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+	}
+
+	fixturePath := flag.String("fixture", "configs/auth-fixture.toml", "TOML or JSON file with users and their tokens")
+	addr := flag.String("addr", "localhost:50051", "address to serve the fake UserService on")
+	flag.Parse()
+
+	fixture, err := fake.LoadFixture(*fixturePath)
+	if err != nil {
+		logg.Fatal("failed to load fixture", "error", err)
+	}
+	svc, err := fake.NewUserService(fixture)
+	if err != nil {
+		logg.Fatal("invalid fixture", "error", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer cancel()
+
+	server, err := fake.Listen(svc, *addr)
+	if err != nil {
+		logg.Fatal("failed to start fake auth", "error", err)
+	}
+	logg.Info("serving fake auth", "addr", *addr, "users", len(fixture.Users))
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	err = server.Wait()
+	if err != nil {
+		logg.Fatal("fake auth stopped", "error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/AndreyChufelin/movies-api/internal/config"
+	"github.com/AndreyChufelin/movies-api/internal/importer"
+	"github.com/AndreyChufelin/movies-api/internal/logger"
+	"github.com/AndreyChufelin/movies-api/internal/storage/postgres"
+)
+
+func main() {
+	defer exitHandler()
+	logg := &logger.Logger{
+		Logger: slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+	}
+
+	configPath := flag.String("config", "configs/config-api.toml", "path to config file")
+	file := flag.String("file", "", "NDJSON or CSV file with movies")
+	format := flag.String("format", "", "file format: ndjson or csv, inferred from the extension by default")
+	dryRun := flag.Bool("dry-run", false, "validate the file without touching the database")
+	report := flag.String("report", "", "file to write line errors to, stderr by default")
+	flag.Parse()
+
+	if *file == "" {
+		logg.Fatal("file is required")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+		if *format == "jsonl" || *format == "json" {
+			*format = importer.FormatNDJSON
+		}
+	}
+
+	config, err := config.LoadConfig(*configPath)
+	if err != nil {
+		logg.Fatal(
+			"failed to load config",
+			"error", err,
+		)
+	}
+	for _, msg := range config.Deprecations() {
+		logg.Warn(msg)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer cancel()
+
+	im, err := importer.NewImporter()
+	if err != nil {
+		logg.Fatal("failed to create importer", "error", err)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		logg.Fatal("failed to open file", "error", err)
+	}
+	defer f.Close()
+
+	records, lineErrs, err := im.Read(f, *format)
+	if err != nil {
+		logg.Fatal("failed to read file", "error", err)
+	}
+	if len(lineErrs) > 0 {
+		if err := writeReport(*report, lineErrs); err != nil {
+			logg.Fatal("failed to write error report", "error", err)
+		}
+	}
+	logg.Info("read file",
+		"valid", len(records),
+		"errors", len(lineErrs),
+	)
+
+	var db postgres.Storage
+	var connected bool
+	defer func() {
+		if connected {
+			db.Close(ctx)
+		}
+	}()
+	open := func(ctx context.Context) (importer.Store, error) {
+		logg.Info("connecting to database")
+		db = postgres.NewStorage(
+			config.DB.Host,
+			config.DB.Port,
+			config.DB.User,
+			config.DB.Password,
+			config.DB.Name,
+			postgres.Options{
+				MaxOpenConns:      config.DB.MaxOpenConns,
+				MaxIdleTime:       config.DB.MaxIdleTime,
+				SSLMode:           config.DB.SSLMode,
+				SSLRootCert:       config.DB.SSLRootCert,
+				ApplicationName:   "movies-importer",
+				HealthCheckPeriod: config.DB.HealthCheckPeriod,
+				ConnectRetries:    config.DB.ConnectRetries,
+				ConnectBackoff:    config.DB.ConnectBackoff,
+			},
+		)
+		err := db.Connect(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		connected = true
+		return &db, nil
+	}
+
+	stats, err := importer.Import(ctx, open, records, *dryRun)
+	if err != nil {
+		logg.Fatal("failed to import movies", "error", err)
+	}
+	if stats == nil {
+		return
+	}
+	logg.Info("imported movies",
+		"inserted", stats.Inserted,
+		"updated", stats.Updated,
+		"unchanged", stats.Unchanged,
+		"skipped", stats.Skipped,
+	)
+}
+
+func writeReport(path string, lineErrs []importer.LineError) error {
+	var w io.Writer = os.Stderr
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return importer.WriteReport(w, lineErrs)
+}
+
+func exitHandler() {
+	if e := recover(); e != nil {
+		if exit, ok := e.(logger.Exit); ok {
+			os.Exit(exit.Code)
+		}
+		panic(e)
+	}
+}
@@ -2,12 +2,17 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net"
+	"slices"
+	"time"
 
 	"github.com/AndreyChufelin/movies-api/internal/logger"
 	"github.com/AndreyChufelin/movies-api/internal/storage"
 	pbuser "github.com/AndreyChufelin/movies-auth/pkg/pb/user"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
@@ -19,17 +24,77 @@ type Auth struct {
 	client pbuser.UserServiceClient
 	addr   string
 	conn   *grpc.ClientConn
+	opts   Options
+	now    func() time.Time
+
+	cache    *tokenCache
+	inflight singleflight.Group
+	breaker  *breaker
+	tls      *tlsReloader
 }
 
-func NewAuth(log *logger.Logger, host, port string) *Auth {
-	return &Auth{
+// Options tune the token cache and the calls to movies-auth. A zero
+// CacheSize disables the cache, a zero BreakerThreshold the breaker and a
+// zero CallTimeout leaves calls to movies-auth unbounded.
+type Options struct {
+	CacheSize   int
+	CacheTTL    time.Duration
+	NegativeTTL time.Duration
+
+	CallTimeout      time.Duration
+	MaxRetries       int
+	RetryBackoff     time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	TLS TLSOptions
+
+	// Dialer replaces the network dial, e.g. to reach an in-process fake
+	// over bufconn.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+func NewAuth(log *logger.Logger, host, port string, opts Options) *Auth {
+	a := &Auth{
 		logger: log,
 		addr:   net.JoinHostPort(host, port),
+		opts:   opts,
+		now:    time.Now,
+	}
+	if opts.CacheSize > 0 {
+		a.cache = newTokenCache(opts.CacheSize)
 	}
+	if opts.BreakerThreshold > 0 {
+		a.breaker = newBreaker(log, opts.BreakerThreshold, opts.BreakerCooldown)
+	}
+	return a
 }
 
 func (a *Auth) Start() error {
-	conn, err := grpc.NewClient(a.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	creds := insecure.NewCredentials()
+	if a.opts.TLS.Enabled {
+		reloader, err := newTLSReloader(a.logger, a.opts.TLS)
+		if err != nil {
+			a.logger.Error("failed to load auth certificates", "error", err)
+			return err
+		}
+		err = reloader.watch()
+		if err != nil {
+			a.logger.Error("failed to watch auth certificates", "error", err)
+			return err
+		}
+		a.tls = reloader
+		creds = reloader.credentials()
+	}
+
+	target := a.addr
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if a.opts.Dialer != nil {
+		target = "passthrough:///" + a.addr
+		dialOpts = append(dialOpts, grpc.WithContextDialer(a.opts.Dialer))
+	}
+
+	conn, err := grpc.NewClient(target, dialOpts...)
 	if err != nil {
 		a.logger.Error("failed to connect to auth grpc")
 		return err
@@ -46,23 +111,164 @@ func (a *Auth) Close() error {
 	if err != nil {
 		return fmt.Errorf("failed to connect to grpc client: %w", err)
 	}
+	if a.tls != nil {
+		err = a.tls.close()
+		if err != nil {
+			return fmt.Errorf("failed to stop certificate watcher: %w", err)
+		}
+	}
 
 	return nil
 }
 
+// Verify returns the user the token belongs to. Answers from movies-auth are
+// cached by token hash, rejected tokens for NegativeTTL, and concurrent
+// lookups of the same token share a single call.
 func (a *Auth) Verify(ctx context.Context, token string) (*storage.User, error) {
+	if a.cache == nil {
+		return a.verify(ctx, token)
+	}
+
+	key := hashToken(token)
+	if user, ok := a.cache.get(key, a.now()); ok {
+		if user == nil {
+			cacheMetrics.Add("negative_hits", 1)
+			return nil, storage.ErrInvalidToken
+		}
+		cacheMetrics.Add("hits", 1)
+		return copyUser(user), nil
+	}
+	cacheMetrics.Add("misses", 1)
+
+	// The shared call must not fail for everyone when the request that
+	// started it goes away or runs out of time, so it ignores the caller's
+	// cancellation and deadline and each caller waits on its own context.
+	// It is bounded by sharedCallTimeout instead, so a hung movies-auth
+	// cannot hold the slot forever.
+	result := a.inflight.DoChan(string(key[:]), func() (any, error) {
+		callCtx := context.WithoutCancel(ctx)
+		if a.opts.CallTimeout > 0 {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithTimeout(callCtx, a.sharedCallTimeout())
+			defer cancel()
+		}
+		gen := a.cache.generation()
+		user, err := a.verify(callCtx, token)
+		if errors.Is(err, context.DeadlineExceeded) {
+			// Only the shared bound can expire here; to the callers it is
+			// an outage like any other timeout.
+			err = fmt.Errorf("%w: %w", storage.ErrAuthUnavailable, err)
+		}
+		switch {
+		case err == nil && a.opts.CacheTTL > 0:
+			a.cache.addAt(gen, key, user, a.now().Add(a.opts.CacheTTL))
+		case errors.Is(err, storage.ErrInvalidToken) && a.opts.NegativeTTL > 0:
+			a.cache.addAt(gen, key, nil, a.now().Add(a.opts.NegativeTTL))
+		}
+		return user, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Shared {
+			cacheMetrics.Add("shared", 1)
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return copyUser(res.Val.(*storage.User)), nil
+	}
+}
+
+// Invalidate drops the cached answer for the token, for example after the
+// user logs out.
+func (a *Auth) Invalidate(token string) {
+	if a.cache == nil {
+		return
+	}
+	a.cache.remove(hashToken(token))
+	cacheMetrics.Add("invalidations", 1)
+}
+
+// InvalidateUser drops every cached token of the user, for example after
+// their permissions change, and reports how many there were.
+func (a *Auth) InvalidateUser(id int64) int {
+	if a.cache == nil {
+		return 0
+	}
+	removed := a.cache.removeUser(id)
+	cacheMetrics.Add("invalidations", int64(removed))
+	return removed
+}
+
+// InvalidateAll empties the cache.
+func (a *Auth) InvalidateAll() {
+	if a.cache == nil {
+		return
+	}
+	a.cache.clear()
+	cacheMetrics.Add("invalidations", 1)
+}
+
+// verify asks movies-auth about the token, retrying while it is
+// unavailable. Outages and an open breaker surface as
+// storage.ErrAuthUnavailable.
+func (a *Auth) verify(ctx context.Context, token string) (*storage.User, error) {
+	if !a.breaker.allow(a.now()) {
+		return nil, storage.ErrAuthUnavailable
+	}
+
+	var user *storage.User
+	var err error
+	for attempt := 0; ; attempt++ {
+		user, err = a.verifyOnce(ctx, token)
+		if status.Code(err) != codes.Unavailable || attempt >= a.opts.MaxRetries {
+			break
+		}
+		a.logger.Warn("auth unavailable, retrying", "attempt", attempt+1, "error", err)
+		if err = sleep(ctx, backoff(a.opts.RetryBackoff, attempt)); err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			a.breaker.abort()
+			return nil, ctx.Err()
+		}
+		switch status.Code(err) {
+		case codes.Unauthenticated, codes.InvalidArgument:
+			a.breaker.success()
+			a.logger.Warn("invalid token")
+			return nil, storage.ErrInvalidToken
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+			a.breaker.failure(a.now())
+			a.logger.Error("auth unavailable", "error", err)
+			return nil, fmt.Errorf("%w: %w", storage.ErrAuthUnavailable, err)
+		default:
+			a.breaker.success()
+			a.logger.Error("failed to verify token", "error", err)
+			return nil, fmt.Errorf("failed to verify token: %w", err)
+		}
+	}
+	a.breaker.success()
+
+	return user, nil
+}
+
+func (a *Auth) verifyOnce(ctx context.Context, token string) (*storage.User, error) {
+	if a.opts.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.opts.CallTimeout)
+		defer cancel()
+	}
 	u, err := a.client.VerifyToken(ctx, &pbuser.VerifyTokenRequest{
 		Token: token,
 	})
 	if err != nil {
-		if grpcErr, ok := status.FromError(err); ok {
-			if grpcErr.Code() == codes.Unauthenticated || grpcErr.Code() == codes.InvalidArgument {
-				a.logger.Warn("invalid token")
-				return nil, storage.ErrInvalidToken
-			}
-		}
-		a.logger.Error("failed to verify token", "error", err)
-		return nil, fmt.Errorf("failed to verify token: %w", err)
+		return nil, err
 	}
 
 	user := &storage.User{
@@ -72,3 +278,41 @@ func (a *Auth) Verify(ctx context.Context, token string) (*storage.User, error)
 	}
 	return user, nil
 }
+
+// sharedCallTimeout covers every attempt of a lookup and the longest
+// backoff between them.
+func (a *Auth) sharedCallTimeout() time.Duration {
+	d := a.opts.CallTimeout * time.Duration(a.opts.MaxRetries+1)
+	for attempt := range a.opts.MaxRetries {
+		b := a.opts.RetryBackoff << attempt
+		d += b + b/2
+	}
+	return d
+}
+
+// backoff doubles base with every attempt and adds up to half of it again
+// as jitter, so retrying instances do not stampede a recovering service.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << attempt
+	if d <= 0 {
+		return 0
+	}
+	return d + rand.N(d/2+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func copyUser(user *storage.User) *storage.User {
+	u := *user
+	u.Permissions = slices.Clone(user.Permissions)
+	return &u
+}
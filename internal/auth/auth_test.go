@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/logger"
+	pbuser "github.com/AndreyChufelin/movies-auth/pkg/pb/user"
+	"google.golang.org/grpc"
+)
+
+func newTestLogger() *logger.Logger {
+	return &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+// fakeClient answers VerifyToken with verify and counts the calls.
+type fakeClient struct {
+	pbuser.UserServiceClient
+	calls  atomic.Int32
+	verify func(ctx context.Context, token string) (*pbuser.VerifyTokenResponse, error)
+}
+
+func (c *fakeClient) VerifyToken(
+	ctx context.Context,
+	in *pbuser.VerifyTokenRequest,
+	_ ...grpc.CallOption,
+) (*pbuser.VerifyTokenResponse, error) {
+	c.calls.Add(1)
+	return c.verify(ctx, in.GetToken())
+}
+
+// clock is a settable time source for TTL and breaker tests.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newClock() *clock {
+	return &clock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestAuth(t *testing.T, client pbuser.UserServiceClient, opts Options, clk *clock) *Auth {
+	t.Helper()
+
+	a := NewAuth(newTestLogger(), "localhost", "0", opts)
+	a.client = client
+	if clk != nil {
+		a.now = clk.Now
+	}
+	return a
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/logger"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breakerMetrics is published at /debug/vars as auth_breaker.
+var breakerMetrics = expvar.NewMap("auth_breaker")
+
+// breaker stops calls to movies-auth after threshold consecutive failures.
+// Once cooldown has passed a single probe is let through: its success closes
+// the breaker again, its failure reopens it for another cooldown.
+type breaker struct {
+	mu        sync.Mutex
+	logger    *logger.Logger
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+func newBreaker(log *logger.Logger, threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		logger:    log,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether a call may go out. A nil breaker allows everything.
+func (b *breaker) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			breakerMetrics.Add("rejected", 1)
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			breakerMetrics.Add("rejected", 1)
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != breakerClosed {
+		b.setState(breakerClosed)
+	}
+}
+
+func (b *breaker) failure(now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breakerMetrics.Add("failures", 1)
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = now
+		if b.state != breakerOpen {
+			b.setState(breakerOpen)
+		}
+	}
+}
+
+// abort releases a probe whose outcome is unknown, e.g. because the caller
+// went away, so the next call can probe instead.
+func (b *breaker) abort() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) setState(state breakerState) {
+	b.logger.Warn("auth circuit breaker state changed", "from", b.state.String(), "to", state.String())
+	b.state = state
+	breakerMetrics.Add(state.String(), 1)
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	pbuser "github.com/AndreyChufelin/movies-auth/pkg/pb/user"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	b := newBreaker(newTestLogger(), 3, time.Minute)
+	now := time.Now()
+
+	for i := range 2 {
+		if !b.allow(now) {
+			t.Fatalf("closed breaker rejected call %d", i)
+		}
+		b.failure(now)
+	}
+	b.success()
+	for range 2 {
+		b.allow(now)
+		b.failure(now)
+	}
+	if b.state != breakerClosed {
+		t.Fatalf("a success should reset the failure count, state = %s", b.state)
+	}
+
+	b.allow(now)
+	b.failure(now)
+	if b.state != breakerOpen {
+		t.Fatalf("state after %d failures = %s, want open", b.threshold, b.state)
+	}
+	if b.allow(now.Add(time.Minute - time.Second)) {
+		t.Fatal("open breaker allowed a call during the cooldown")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow(now) {
+		t.Fatal("breaker did not let a probe through after the cooldown")
+	}
+	if b.state != breakerHalfOpen {
+		t.Fatalf("state while probing = %s, want half-open", b.state)
+	}
+	if b.allow(now) {
+		t.Fatal("half-open breaker let a second probe through")
+	}
+
+	b.failure(now)
+	if b.state != breakerOpen {
+		t.Fatalf("state after a failed probe = %s, want open", b.state)
+	}
+	if b.allow(now.Add(time.Second)) {
+		t.Fatal("failed probe did not restart the cooldown")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow(now) {
+		t.Fatal("breaker did not let a probe through after the second cooldown")
+	}
+	b.abort()
+	if !b.allow(now) {
+		t.Fatal("aborted probe was not released")
+	}
+	b.success()
+	if b.state != breakerClosed {
+		t.Fatalf("state after a successful probe = %s, want closed", b.state)
+	}
+	if !b.allow(now) || !b.allow(now) {
+		t.Fatal("closed breaker rejected calls")
+	}
+}
+
+func TestNilBreakerAllowsEverything(t *testing.T) {
+	var b *breaker
+	b.failure(time.Now())
+	if !b.allow(time.Now()) {
+		t.Fatal("nil breaker rejected a call")
+	}
+}
+
+func TestVerifyOpensBreaker(t *testing.T) {
+	clk := newClock()
+	up := false
+	client := &fakeClient{verify: func(context.Context, string) (*pbuser.VerifyTokenResponse, error) {
+		if !up {
+			return nil, status.Error(codes.Unavailable, "down")
+		}
+		return &pbuser.VerifyTokenResponse{Id: 1}, nil
+	}}
+	a := newTestAuth(t, client, Options{BreakerThreshold: 2, BreakerCooldown: time.Minute}, clk)
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := a.Verify(ctx, "token"); !errors.Is(err, storage.ErrAuthUnavailable) {
+			t.Fatalf("Verify error = %v, want ErrAuthUnavailable", err)
+		}
+	}
+	if _, err := a.Verify(ctx, "token"); !errors.Is(err, storage.ErrAuthUnavailable) {
+		t.Fatalf("Verify error with open breaker = %v, want ErrAuthUnavailable", err)
+	}
+	if calls := client.calls.Load(); calls != 2 {
+		t.Fatalf("open breaker let calls through: %d, want 2", calls)
+	}
+
+	up = true
+	clk.Advance(time.Minute)
+	if _, err := a.Verify(ctx, "token"); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if a.breaker.state != breakerClosed {
+		t.Fatalf("state after a successful probe = %s, want closed", a.breaker.state)
+	}
+}
+
+func TestVerifyRetriesOnlyUnavailable(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes []codes.Code
+		calls int32
+		err   error
+	}{
+		{name: "recovers", codes: []codes.Code{codes.Unavailable, codes.OK}, calls: 2},
+		{name: "gives up", codes: []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable}, calls: 3, err: storage.ErrAuthUnavailable},
+		{name: "invalid token", codes: []codes.Code{codes.Unauthenticated}, calls: 1, err: storage.ErrInvalidToken},
+		{name: "invalid argument", codes: []codes.Code{codes.InvalidArgument}, calls: 1, err: storage.ErrInvalidToken},
+		{name: "deadline", codes: []codes.Code{codes.DeadlineExceeded}, calls: 1, err: storage.ErrAuthUnavailable},
+		{name: "internal", codes: []codes.Code{codes.Internal}, calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{}
+			client.verify = func(context.Context, string) (*pbuser.VerifyTokenResponse, error) {
+				code := tt.codes[client.calls.Load()-1]
+				if code == codes.OK {
+					return &pbuser.VerifyTokenResponse{Id: 1}, nil
+				}
+				return nil, status.Error(code, code.String())
+			}
+			a := newTestAuth(t, client, Options{MaxRetries: 2, RetryBackoff: time.Millisecond}, nil)
+
+			_, err := a.Verify(context.Background(), "token")
+			switch {
+			case tt.name == "internal":
+				if err == nil || errors.Is(err, storage.ErrAuthUnavailable) || errors.Is(err, storage.ErrInvalidToken) {
+					t.Fatalf("Verify error = %v, want a plain failure", err)
+				}
+			case !errors.Is(err, tt.err):
+				t.Fatalf("Verify error = %v, want %v", err, tt.err)
+			}
+			if calls := client.calls.Load(); calls != tt.calls {
+				t.Fatalf("VerifyToken called %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestVerifySharedCallOutlivesStarterDeadline(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	client := &fakeClient{verify: func(ctx context.Context, _ string) (*pbuser.VerifyTokenResponse, error) {
+		close(started)
+		select {
+		case <-release:
+			return &pbuser.VerifyTokenResponse{Id: 1, Activated: true}, nil
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}}
+	a := newTestAuth(t, client, Options{CacheSize: 10, CacheTTL: time.Minute, CallTimeout: time.Second}, nil)
+
+	// A request on a route with a short timeout starts the call...
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	first := make(chan error, 1)
+	go func() {
+		_, err := a.Verify(short, "token")
+		first <- err
+	}()
+	<-started
+
+	// ...and one with plenty of time left joins it.
+	second := make(chan error, 1)
+	go func() {
+		_, err := a.Verify(context.Background(), "token")
+		second <- err
+	}()
+
+	if err := <-first; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("first Verify error = %v, want context.DeadlineExceeded", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Fatalf("second Verify error = %v, want the shared answer", err)
+	}
+	if calls := client.calls.Load(); calls != 1 {
+		t.Fatalf("VerifyToken called %d times, want 1", calls)
+	}
+}
+
+func TestVerifyBoundsSharedCall(t *testing.T) {
+	client := &fakeClient{verify: func(ctx context.Context, _ string) (*pbuser.VerifyTokenResponse, error) {
+		// A hung movies-auth that is slow to notice a cancelled attempt and
+		// then drops the connection, so the attempts overrun the bound.
+		<-ctx.Done()
+		time.Sleep(30 * time.Millisecond)
+		return nil, status.Error(codes.Unavailable, "connection reset")
+	}}
+	a := newTestAuth(t, client, Options{
+		CacheSize:    10,
+		CacheTTL:     time.Minute,
+		CallTimeout:  20 * time.Millisecond,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}, nil)
+	if got, want := a.sharedCallTimeout(), 60*time.Millisecond+4500*time.Microsecond; got != want {
+		t.Fatalf("sharedCallTimeout = %v, want %v", got, want)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.Verify(context.Background(), "token")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, storage.ErrAuthUnavailable) {
+			t.Fatalf("Verify error = %v, want ErrAuthUnavailable", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shared call was not bounded")
+	}
+	// Unbounded, all three attempts would have run.
+	if calls := client.calls.Load(); calls >= 3 {
+		t.Fatalf("VerifyToken called %d times, want the bound to stop the retries", calls)
+	}
+}
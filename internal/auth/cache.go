@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+// cacheMetrics is published at /debug/vars as auth_token_cache.
+var cacheMetrics = expvar.NewMap("auth_token_cache")
+
+type tokenKey [sha256.Size]byte
+
+// hashToken keys the cache so raw tokens are never kept in memory longer
+// than a request.
+func hashToken(token string) tokenKey {
+	return sha256.Sum256([]byte(token))
+}
+
+type cacheEntry struct {
+	key     tokenKey
+	user    *storage.User
+	expires time.Time
+}
+
+// tokenCache is a fixed size LRU of verified tokens. A nil user records a
+// token movies-auth rejected.
+type tokenCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[tokenKey]*list.Element
+	// gen changes with every invalidation, see addAt.
+	gen uint64
+}
+
+func newTokenCache(size int) *tokenCache {
+	return &tokenCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[tokenKey]*list.Element),
+	}
+}
+
+func (c *tokenCache) get(key tokenKey, now time.Time) (*storage.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		c.removeElement(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+
+	return entry.user, true
+}
+
+func (c *tokenCache) add(key tokenKey, user *storage.User, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addLocked(key, user, expires)
+}
+
+// generation is read before asking movies-auth and handed to addAt.
+func (c *tokenCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+// addAt adds an answer fetched at generation gen. An answer that raced an
+// invalidation is dropped, since it may carry what was just invalidated.
+func (c *tokenCache) addAt(gen uint64, key tokenKey, user *storage.User, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen == c.gen {
+		c.addLocked(key, user, expires)
+	}
+}
+
+// addLocked must be called with c.mu held.
+func (c *tokenCache) addLocked(key tokenKey, user *storage.User, expires time.Time) {
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.user, entry.expires = user, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, user: user, expires: expires})
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+		cacheMetrics.Add("evictions", 1)
+	}
+}
+
+func (c *tokenCache) remove(key tokenKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// removeUser drops every cached token of the user and reports how many
+// there were.
+func (c *tokenCache) removeUser(id int64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	removed := 0
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		if user := elem.Value.(*cacheEntry).user; user != nil && user.ID == id {
+			c.removeElement(elem)
+			removed++
+		}
+		elem = next
+	}
+	return removed
+}
+
+func (c *tokenCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.order.Init()
+	clear(c.entries)
+}
+
+// removeElement must be called with c.mu held.
+func (c *tokenCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	pbuser "github.com/AndreyChufelin/movies-auth/pkg/pb/user"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newTokenCache(2)
+	now := time.Now()
+	expires := now.Add(time.Minute)
+	a, b, d := hashToken("a"), hashToken("b"), hashToken("d")
+
+	c.add(a, &storage.User{ID: 1}, expires)
+	c.add(b, &storage.User{ID: 2}, expires)
+	if _, ok := c.get(a, now); !ok {
+		t.Fatal("a is missing")
+	}
+	c.add(d, &storage.User{ID: 3}, expires)
+
+	if _, ok := c.get(b, now); ok {
+		t.Fatal("b should have been evicted as least recently used")
+	}
+	for _, key := range []tokenKey{a, d} {
+		if _, ok := c.get(key, now); !ok {
+			t.Fatalf("entry %x was evicted", key[:4])
+		}
+	}
+	if c.order.Len() != 2 || len(c.entries) != 2 {
+		t.Fatalf("cache holds %d/%d entries, want 2", c.order.Len(), len(c.entries))
+	}
+}
+
+func TestTokenCacheExpiry(t *testing.T) {
+	c := newTokenCache(10)
+	now := time.Now()
+	key, negative := hashToken("valid"), hashToken("rejected")
+	c.add(key, &storage.User{ID: 1}, now.Add(time.Minute))
+	c.add(negative, nil, now.Add(time.Second))
+
+	if user, ok := c.get(negative, now); !ok || user != nil {
+		t.Fatalf("negative entry = %v, %v; want nil, true", user, ok)
+	}
+	if _, ok := c.get(negative, now.Add(time.Second)); ok {
+		t.Fatal("negative entry did not expire")
+	}
+	if _, ok := c.get(key, now.Add(time.Minute-time.Nanosecond)); !ok {
+		t.Fatal("entry expired early")
+	}
+	if _, ok := c.get(key, now.Add(time.Minute)); ok {
+		t.Fatal("entry did not expire")
+	}
+	if len(c.entries) != 0 {
+		t.Fatalf("expired entries were kept: %d", len(c.entries))
+	}
+}
+
+func TestTokenCacheRemoveUser(t *testing.T) {
+	c := newTokenCache(10)
+	now := time.Now()
+	expires := now.Add(time.Minute)
+	c.add(hashToken("a1"), &storage.User{ID: 1}, expires)
+	c.add(hashToken("a2"), &storage.User{ID: 1}, expires)
+	c.add(hashToken("b"), &storage.User{ID: 2}, expires)
+	c.add(hashToken("rejected"), nil, expires)
+
+	if removed := c.removeUser(1); removed != 2 {
+		t.Fatalf("removed %d entries, want 2", removed)
+	}
+	for _, token := range []string{"a1", "a2"} {
+		if _, ok := c.get(hashToken(token), now); ok {
+			t.Fatalf("token %s of user 1 is still cached", token)
+		}
+	}
+	for _, token := range []string{"b", "rejected"} {
+		if _, ok := c.get(hashToken(token), now); !ok {
+			t.Fatalf("token %s was removed", token)
+		}
+	}
+}
+
+func TestVerifyCachesWithTTL(t *testing.T) {
+	clk := newClock()
+	client := &fakeClient{verify: func(_ context.Context, token string) (*pbuser.VerifyTokenResponse, error) {
+		if token != "valid" {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return &pbuser.VerifyTokenResponse{Id: 7, Activated: true, Permissions: []string{"movies:read"}}, nil
+	}}
+	a := newTestAuth(t, client, Options{CacheSize: 10, CacheTTL: time.Minute, NegativeTTL: 5 * time.Second}, clk)
+	ctx := context.Background()
+
+	for range 3 {
+		user, err := a.Verify(ctx, "valid")
+		if err != nil || user.ID != 7 {
+			t.Fatalf("Verify = %+v, %v", user, err)
+		}
+	}
+	if calls := client.calls.Load(); calls != 1 {
+		t.Fatalf("VerifyToken called %d times, want 1", calls)
+	}
+
+	for range 3 {
+		if _, err := a.Verify(ctx, "bogus"); !errors.Is(err, storage.ErrInvalidToken) {
+			t.Fatalf("Verify(bogus) error = %v", err)
+		}
+	}
+	if calls := client.calls.Load(); calls != 2 {
+		t.Fatalf("VerifyToken called %d times, want 2", calls)
+	}
+
+	clk.Advance(5 * time.Second)
+	if _, err := a.Verify(ctx, "bogus"); !errors.Is(err, storage.ErrInvalidToken) {
+		t.Fatalf("Verify(bogus) error = %v", err)
+	}
+	if _, err := a.Verify(ctx, "valid"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := client.calls.Load(); calls != 3 {
+		t.Fatalf("VerifyToken called %d times after NegativeTTL, want 3", calls)
+	}
+
+	clk.Advance(time.Minute)
+	if _, err := a.Verify(ctx, "valid"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := client.calls.Load(); calls != 4 {
+		t.Fatalf("VerifyToken called %d times after CacheTTL, want 4", calls)
+	}
+
+	a.Invalidate("valid")
+	if _, err := a.Verify(ctx, "valid"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := client.calls.Load(); calls != 5 {
+		t.Fatalf("VerifyToken called %d times after Invalidate, want 5", calls)
+	}
+	if removed := a.InvalidateUser(7); removed != 1 {
+		t.Fatalf("InvalidateUser removed %d tokens, want 1", removed)
+	}
+}
+
+func TestVerifyDoesNotCacheOutages(t *testing.T) {
+	client := &fakeClient{verify: func(context.Context, string) (*pbuser.VerifyTokenResponse, error) {
+		return nil, status.Error(codes.Unavailable, "down")
+	}}
+	a := newTestAuth(t, client, Options{CacheSize: 10, CacheTTL: time.Minute, NegativeTTL: time.Minute}, newClock())
+
+	for range 2 {
+		if _, err := a.Verify(context.Background(), "token"); !errors.Is(err, storage.ErrAuthUnavailable) {
+			t.Fatalf("Verify error = %v, want ErrAuthUnavailable", err)
+		}
+	}
+	if calls := client.calls.Load(); calls != 2 {
+		t.Fatalf("VerifyToken called %d times, want 2", calls)
+	}
+}
+
+func TestVerifyReturnsCopies(t *testing.T) {
+	client := &fakeClient{verify: func(context.Context, string) (*pbuser.VerifyTokenResponse, error) {
+		return &pbuser.VerifyTokenResponse{Id: 1, Activated: true, Permissions: []string{"movies:read"}}, nil
+	}}
+	a := newTestAuth(t, client, Options{CacheSize: 10, CacheTTL: time.Minute}, newClock())
+	ctx := context.Background()
+
+	first, err := a.Verify(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Activated = false
+	first.Permissions[0] = "movies:write"
+	first.Permissions = append(first.Permissions, "movies:purge")
+
+	second, err := a.Verify(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Activated || len(second.Permissions) != 1 || second.Permissions[0] != "movies:read" {
+		t.Fatalf("cached user was modified through a returned copy: %+v", second)
+	}
+}
+
+func TestVerifyCollapsesConcurrentMisses(t *testing.T) {
+	const callers = 20
+	release := make(chan struct{})
+	client := &fakeClient{verify: func(context.Context, string) (*pbuser.VerifyTokenResponse, error) {
+		<-release
+		return &pbuser.VerifyTokenResponse{Id: 1, Activated: true}, nil
+	}}
+	// Without a positive TTL nothing is cached, so every caller that does
+	// not share the in-flight call would reach the client.
+	a := newTestAuth(t, client, Options{CacheSize: 10}, newClock())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.Verify(context.Background(), "token")
+			errs <- err
+		}()
+	}
+	// Give every caller time to join the call before it completes.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := client.calls.Load(); calls != 1 {
+		t.Fatalf("VerifyToken called %d times for %d concurrent callers, want 1", calls, callers)
+	}
+}
+
+func TestVerifyWaiterHonoursItsContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	client := &fakeClient{verify: func(context.Context, string) (*pbuser.VerifyTokenResponse, error) {
+		<-release
+		return &pbuser.VerifyTokenResponse{Id: 1}, nil
+	}}
+	a := newTestAuth(t, client, Options{CacheSize: 10, CacheTTL: time.Minute}, newClock())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := a.Verify(ctx, "token"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Verify error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestVerifyDoesNotCacheAcrossInvalidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(a *Auth)
+	}{
+		{name: "token", invalidate: func(a *Auth) { a.Invalidate("token") }},
+		{name: "user", invalidate: func(a *Auth) { a.InvalidateUser(1) }},
+		{name: "all", invalidate: func(a *Auth) { a.InvalidateAll() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{}, 1)
+			release := make(chan struct{})
+			client := &fakeClient{verify: func(context.Context, string) (*pbuser.VerifyTokenResponse, error) {
+				started <- struct{}{}
+				<-release
+				return &pbuser.VerifyTokenResponse{Id: 1, Activated: true, Permissions: []string{"movies:write"}}, nil
+			}}
+			a := newTestAuth(t, client, Options{CacheSize: 10, CacheTTL: time.Minute}, newClock())
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := a.Verify(context.Background(), "token")
+				done <- err
+			}()
+			<-started
+
+			// The lookup was answered before the permissions changed, so
+			// its answer must not outlive the invalidation in the cache.
+			tt.invalidate(a)
+			close(release)
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := a.Verify(context.Background(), "token"); err != nil {
+				t.Fatal(err)
+			}
+			if calls := client.calls.Load(); calls != 2 {
+				t.Fatalf("VerifyToken called %d times, want 2", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package fake is a stand-in for movies-auth that answers VerifyToken from a
+// fixture file. It is meant for development and tests only.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	pbuser "github.com/AndreyChufelin/movies-auth/pkg/pb/user"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1 << 20
+
+// User is a fixture user and the tokens that authenticate as them.
+type User struct {
+	ID          int64
+	Activated   bool
+	Permissions []string
+	Tokens      []string
+}
+
+type Fixture struct {
+	Users []User
+}
+
+// LoadFixture reads a TOML or JSON fixture, picked by the file extension.
+func LoadFixture(path string) (*Fixture, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading fixture: %w", err)
+	}
+
+	var fixture Fixture
+	err = v.Unmarshal(&fixture)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fixture: %w", err)
+	}
+
+	return &fixture, nil
+}
+
+// UserService implements the VerifyToken part of movies-auth. Unknown
+// tokens get codes.Unauthenticated, as from the real service.
+type UserService struct {
+	pbuser.UnimplementedUserServiceServer
+	tokens map[string]User
+}
+
+func NewUserService(fixture *Fixture) (*UserService, error) {
+	tokens := make(map[string]User)
+	for _, u := range fixture.Users {
+		for _, token := range u.Tokens {
+			if _, ok := tokens[token]; ok {
+				return nil, fmt.Errorf("token %q is assigned to more than one user", token)
+			}
+			tokens[token] = u
+		}
+	}
+
+	return &UserService{tokens: tokens}, nil
+}
+
+func (s *UserService) VerifyToken(
+	_ context.Context,
+	req *pbuser.VerifyTokenRequest,
+) (*pbuser.VerifyTokenResponse, error) {
+	u, ok := s.tokens[req.GetToken()]
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	return &pbuser.VerifyTokenResponse{
+		Id:          u.ID,
+		Activated:   u.Activated,
+		Permissions: u.Permissions,
+	}, nil
+}
+
+// Server serves a UserService over gRPC, either on a real listener or on an
+// in-memory bufconn one.
+type Server struct {
+	grpc *grpc.Server
+	buf  *bufconn.Listener
+	errs chan error
+}
+
+func newServer(svc *UserService, lis net.Listener) *Server {
+	s := &Server{
+		grpc: grpc.NewServer(),
+		errs: make(chan error, 1),
+	}
+	pbuser.RegisterUserServiceServer(s.grpc, svc)
+	go func() {
+		s.errs <- s.grpc.Serve(lis)
+	}()
+
+	return s
+}
+
+// Listen serves svc on addr, e.g. "localhost:50051".
+func Listen(svc *UserService, addr string) (*Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	return newServer(svc, lis), nil
+}
+
+// NewBufconn serves svc in memory. Connect to it with Dial.
+func NewBufconn(svc *UserService) *Server {
+	buf := bufconn.Listen(bufSize)
+	s := newServer(svc, buf)
+	s.buf = buf
+
+	return s
+}
+
+// Dial connects to a bufconn server. It fits grpc.WithContextDialer and
+// auth.Options.Dialer.
+func (s *Server) Dial(ctx context.Context, _ string) (net.Conn, error) {
+	return s.buf.DialContext(ctx)
+}
+
+// Wait blocks until the server stops and returns why it did.
+func (s *Server) Wait() error {
+	return <-s.errs
+}
+
+func (s *Server) Close() {
+	s.grpc.GracefulStop()
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+)
+
+const maxJWKSSize = 1 << 20
+
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+type jwk struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+type keySet []*jwk
+
+// find returns the key with the given kid. A single key without a kid, as
+// loaded from a PEM file, is used for every token.
+func (s keySet) find(kid string) *jwk {
+	for _, k := range s {
+		if k.kid == kid {
+			return k
+		}
+	}
+	if len(s) == 1 && s[0].kid == "" {
+		return s[0]
+	}
+	return nil
+}
+
+func loadPublicKeyFile(path string) (keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	var key crypto.PublicKey
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		key = cert.PublicKey
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+	return keySet{{key: key}}, nil
+}
+
+func loadJWKSFile(path string) (keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks: %w", err)
+	}
+	return parseJWKS(data)
+}
+
+func fetchJWKS(ctx context.Context, url string) (keySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jwks request: %w", err)
+	}
+	resp, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks: unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks: %w", err)
+	}
+	return parseJWKS(data)
+}
+
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS keeps the signing keys it understands and skips the rest, so a
+// set that also publishes other keys still works.
+func parseJWKS(data []byte) (keySet, error) {
+	var raw struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %w", err)
+	}
+
+	var keys keySet
+	for _, k := range raw.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, &jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no usable signing keys")
+	}
+
+	return keys, nil
+}
+
+func (k rawJWK) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("unsupported rsa key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		return ecPublicKey(k.Crv, k.X, k.Y)
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func ecPublicKey(crv, xs, ys string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	var check ecdh.Curve
+	switch crv {
+	case "P-256":
+		curve, check = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, check = elliptic.P384(), ecdh.P384()
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", crv)
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+	x, err := base64.RawURLEncoding.DecodeString(xs)
+	if err != nil || len(x) != size {
+		return nil, errors.New("invalid ec key")
+	}
+	y, err := base64.RawURLEncoding.DecodeString(ys)
+	if err != nil || len(y) != size {
+		return nil, errors.New("invalid ec key")
+	}
+
+	// ecdh rejects points that are not on the curve.
+	point := append(append([]byte{4}, x...), y...)
+	_, err = check.NewPublicKey(point)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ec key: %w", err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
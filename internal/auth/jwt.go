@@ -0,0 +1,381 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/logger"
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+// JWTOptions configure local token verification. Exactly one key source
+// must be set: PublicKeyFile (PEM), JWKSFile or JWKSURL. Keys are reloaded
+// every RefreshInterval and when a token names an unknown kid.
+type JWTOptions struct {
+	PublicKeyFile   string
+	JWKSFile        string
+	JWKSURL         string
+	RefreshInterval time.Duration
+	Issuer          string
+	Audience        string
+	ClockSkew       time.Duration
+}
+
+// minKeyRefresh limits how often an unknown kid may trigger a reload, so
+// garbage tokens cannot be used to hammer the JWKS endpoint.
+const minKeyRefresh = 30 * time.Second
+
+// keyLoadTimeout bounds a reload. It does not depend on the request that
+// triggered it, since the keys are shared by every request.
+const keyLoadTimeout = 10 * time.Second
+
+// JWTVerifier authenticates users by verifying signed JWTs issued by
+// movies-auth, without calling it. The subject is the user ID and the
+// activated and permissions claims carry the rest of storage.User.
+type JWTVerifier struct {
+	logger *logger.Logger
+	opts   JWTOptions
+	now    func() time.Time
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu          sync.RWMutex
+	keys        keySet
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+}
+
+func NewJWTVerifier(log *logger.Logger, opts JWTOptions) *JWTVerifier {
+	return &JWTVerifier{
+		logger: log,
+		opts:   opts,
+		now:    time.Now,
+		done:   make(chan struct{}),
+	}
+}
+
+func (v *JWTVerifier) Start() error {
+	sources := 0
+	for _, s := range []string{v.opts.PublicKeyFile, v.opts.JWKSFile, v.opts.JWKSURL} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("exactly one of public_key_file, jwks_file and jwks_url must be set")
+	}
+
+	err := v.refresh(true)
+	if err != nil {
+		v.logger.Error("failed to load jwt keys", "error", err)
+		return err
+	}
+
+	if v.opts.RefreshInterval > 0 {
+		v.wg.Add(1)
+		go v.refreshLoop()
+	}
+
+	return nil
+}
+
+func (v *JWTVerifier) Close() error {
+	close(v.done)
+	v.wg.Wait()
+	return nil
+}
+
+func (v *JWTVerifier) refreshLoop() {
+	defer v.wg.Done()
+	ticker := time.NewTicker(v.opts.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-v.done:
+			return
+		case <-ticker.C:
+			err := v.refresh(true)
+			if err != nil {
+				// Keep verifying with the keys we have until the source
+				// comes back.
+				v.logger.Error("failed to refresh jwt keys", "error", err)
+			}
+		}
+	}
+}
+
+// refresh reloads the key set. Unless force is set it does nothing when the
+// last reload was less than minKeyRefresh ago; the check is made under
+// refreshMu, so callers that queue up behind a reload do not repeat it.
+func (v *JWTVerifier) refresh(force bool) error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	if !force && v.now().Sub(v.lastRefresh) < minKeyRefresh {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyLoadTimeout)
+	defer cancel()
+	keys, err := v.loadKeys(ctx)
+	v.lastRefresh = v.now()
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+
+	return nil
+}
+
+func (v *JWTVerifier) loadKeys(ctx context.Context) (keySet, error) {
+	switch {
+	case v.opts.PublicKeyFile != "":
+		return loadPublicKeyFile(v.opts.PublicKeyFile)
+	case v.opts.JWKSFile != "":
+		return loadJWKSFile(v.opts.JWKSFile)
+	default:
+		return fetchJWKS(ctx, v.opts.JWKSURL)
+	}
+}
+
+// key returns the key for kid, reloading the key set once if kid is
+// unknown. It reports storage.ErrAuthUnavailable when no keys are loaded.
+func (v *JWTVerifier) key(kid string) (*jwk, error) {
+	v.mu.RLock()
+	keys := v.keys
+	v.mu.RUnlock()
+	if k := keys.find(kid); k != nil {
+		return k, nil
+	}
+
+	err := v.refresh(false)
+	if err != nil {
+		v.logger.Error("failed to refresh jwt keys", "error", err)
+	}
+	v.mu.RLock()
+	keys = v.keys
+	v.mu.RUnlock()
+	if k := keys.find(kid); k != nil {
+		return k, nil
+	}
+
+	if len(keys) == 0 {
+		return nil, storage.ErrAuthUnavailable
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject     string   `json:"sub"`
+	Issuer      string   `json:"iss"`
+	Audience    audience `json:"aud"`
+	ExpiresAt   *float64 `json:"exp"`
+	NotBefore   *float64 `json:"nbf"`
+	Activated   bool     `json:"activated"`
+	Permissions []string `json:"permissions"`
+}
+
+// audience accepts both forms RFC 7519 allows: a string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if json.Unmarshal(data, &one) == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	err := json.Unmarshal(data, &many)
+	if err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+func (v *JWTVerifier) Verify(_ context.Context, token string) (*storage.User, error) {
+	user, err := v.verify(token)
+	if err != nil {
+		if errors.Is(err, storage.ErrAuthUnavailable) {
+			v.logger.Error("no jwt keys to verify token with")
+			return nil, err
+		}
+		v.logger.Warn("invalid token", "error", err)
+		return nil, storage.ErrInvalidToken
+	}
+	return user, nil
+}
+
+func (v *JWTVerifier) verify(token string) (*storage.User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	err = key.verify(header.Alg, []byte(parts[0]+"."+parts[1]), sig)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("malformed claims: %w", err)
+	}
+	err = v.validate(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("subject is not a user id: %w", err)
+	}
+
+	user := &storage.User{
+		ID:          id,
+		Activated:   claims.Activated,
+		Permissions: claims.Permissions,
+	}
+	return user, nil
+}
+
+func (v *JWTVerifier) validate(claims *jwtClaims) error {
+	now := v.now()
+	if claims.ExpiresAt == nil {
+		return errors.New("token has no exp claim")
+	}
+	if now.Add(-v.opts.ClockSkew).After(numericDate(*claims.ExpiresAt)) {
+		return errors.New("token has expired")
+	}
+	if claims.NotBefore != nil && now.Add(v.opts.ClockSkew).Before(numericDate(*claims.NotBefore)) {
+		return errors.New("token is not valid yet")
+	}
+	if v.opts.Issuer != "" && claims.Issuer != v.opts.Issuer {
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if v.opts.Audience != "" && !slices.Contains(claims.Audience, v.opts.Audience) {
+		return errors.New("token is not meant for this audience")
+	}
+	return nil
+}
+
+func numericDate(v float64) time.Time {
+	sec, frac := int64(v), v-float64(int64(v))
+	return time.Unix(sec, int64(frac*float64(time.Second)))
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	return dec.Decode(v)
+}
+
+// verify checks sig against the algorithm the token names. The algorithm
+// must fit the key type, so a token cannot pick a weaker way to be checked.
+func (k *jwk) verify(alg string, signed, sig []byte) error {
+	if k.alg != "" && k.alg != alg {
+		return fmt.Errorf("key %q does not accept %s", k.kid, alg)
+	}
+
+	switch pub := k.key.(type) {
+	case *rsa.PublicKey:
+		hash, err := rsaHash(alg)
+		if err != nil {
+			return err
+		}
+		h := hash.New()
+		h.Write(signed)
+		return rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig)
+	case *ecdsa.PublicKey:
+		hash, size, err := ecdsaHash(alg, pub)
+		if err != nil {
+			return err
+		}
+		if len(sig) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		h := hash.New()
+		h.Write(signed)
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return fmt.Errorf("algorithm %s does not fit an Ed25519 key", alg)
+		}
+		if !ed25519.Verify(pub, signed, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+func rsaHash(alg string) (crypto.Hash, error) {
+	switch alg {
+	case "RS256":
+		return crypto.SHA256, nil
+	case "RS384":
+		return crypto.SHA384, nil
+	case "RS512":
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("algorithm %s does not fit an RSA key", alg)
+	}
+}
+
+func ecdsaHash(alg string, pub *ecdsa.PublicKey) (crypto.Hash, int, error) {
+	switch {
+	case alg == "ES256" && pub.Curve.Params().Name == "P-256":
+		return crypto.SHA256, 32, nil
+	case alg == "ES384" && pub.Curve.Params().Name == "P-384":
+		return crypto.SHA384, 48, nil
+	default:
+		return 0, 0, fmt.Errorf("algorithm %s does not fit a %s key", alg, pub.Curve.Params().Name)
+	}
+}
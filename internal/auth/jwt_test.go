@@ -0,0 +1,503 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+var testRSAKey = sync.OnceValue(func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+})
+
+func newECKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testKey is a signing key as published in a JWKS. An empty alg leaves the
+// algorithm out of the set.
+type testKey struct {
+	kid  string
+	alg  string
+	priv crypto.Signer
+}
+
+func jwksJSON(t *testing.T, keys ...testKey) []byte {
+	t.Helper()
+
+	enc := base64.RawURLEncoding.EncodeToString
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for _, k := range keys {
+		jwk := map[string]string{"kid": k.kid, "use": "sig"}
+		if k.alg != "" {
+			jwk["alg"] = k.alg
+		}
+		switch pub := k.priv.Public().(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = enc(pub.N.Bytes())
+			jwk["e"] = enc(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk["kty"] = "EC"
+			jwk["crv"] = pub.Curve.Params().Name
+			jwk["x"] = enc(pub.X.FillBytes(make([]byte, size)))
+			jwk["y"] = enc(pub.Y.FillBytes(make([]byte, size)))
+		default:
+			t.Fatalf("unsupported key type %T", pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// signJWT signs claims with priv whatever alg the header names: RSA keys
+// use PKCS #1 v1.5 with the hash of an RS alg or SHA-256, EC keys the hash
+// that fits their curve. That makes tokens whose alg does not fit the key.
+// "none" gets an empty signature.
+func signJWT(t *testing.T, alg, kid string, priv crypto.Signer, claims map[string]any) string {
+	t.Helper()
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	if alg == "none" {
+		return signed + "."
+	}
+
+	var sig []byte
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		hash := crypto.SHA256
+		switch alg {
+		case "RS384":
+			hash = crypto.SHA384
+		case "RS512":
+			hash = crypto.SHA512
+		}
+		h := hash.New()
+		h.Write([]byte(signed))
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, hash, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		hash, size := crypto.SHA256, 32
+		if key.Curve == elliptic.P384() {
+			hash, size = crypto.SHA384, 48
+		}
+		h := hash.New()
+		h.Write([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	default:
+		t.Fatalf("unsupported key type %T", priv)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// withSignature replaces the signature of token with what change makes of it.
+func withSignature(t *testing.T, token string, change func([]byte) []byte) string {
+	t.Helper()
+
+	i := strings.LastIndex(token, ".")
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token[:i+1] + base64.RawURLEncoding.EncodeToString(change(sig))
+}
+
+func testClaims(now time.Time) map[string]any {
+	return map[string]any{
+		"sub":         "42",
+		"iss":         "movies-auth",
+		"aud":         "movies-api",
+		"exp":         now.Add(time.Hour).Unix(),
+		"activated":   true,
+		"permissions": []string{"movies:read"},
+	}
+}
+
+func newTestVerifier(t *testing.T, opts JWTOptions, clk *clock) *JWTVerifier {
+	t.Helper()
+
+	v := NewJWTVerifier(newTestLogger(), opts)
+	v.now = clk.Now
+	err := v.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { v.Close() })
+	return v
+}
+
+// jwksServer serves a key set that can be swapped and counts the fetches.
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu     sync.Mutex
+	body   []byte
+	status int
+}
+
+func newJWKSServer(t *testing.T, body []byte) *jwksServer {
+	t.Helper()
+
+	s := &jwksServer{body: body, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.WriteHeader(s.status)
+		w.Write(s.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(status int, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.body = body
+}
+
+func TestJWTVerifyClaims(t *testing.T) {
+	clk := newClock()
+	key := newECKey(t, elliptic.P256())
+	jwks := newJWKSServer(t, jwksJSON(t, testKey{kid: "k1", priv: key}))
+	v := newTestVerifier(t, JWTOptions{
+		JWKSURL:   jwks.URL,
+		Issuer:    "movies-auth",
+		Audience:  "movies-api",
+		ClockSkew: 30 * time.Second,
+	}, clk)
+	now := clk.Now()
+
+	tests := []struct {
+		name   string
+		change func(claims map[string]any)
+		ok     bool
+	}{
+		{name: "valid", change: func(map[string]any) {}, ok: true},
+		{name: "expired", change: func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() }},
+		{name: "expired within skew", change: func(c map[string]any) { c["exp"] = now.Add(-30 * time.Second).Unix() }, ok: true},
+		{name: "expired past skew", change: func(c map[string]any) { c["exp"] = now.Add(-31 * time.Second).Unix() }},
+		{name: "fractional exp", change: func(c map[string]any) { c["exp"] = float64(now.Unix()) + 0.5 }, ok: true},
+		{name: "missing exp", change: func(c map[string]any) { delete(c, "exp") }},
+		{name: "nbf in the past", change: func(c map[string]any) { c["nbf"] = now.Add(-time.Hour).Unix() }, ok: true},
+		{name: "nbf in the future", change: func(c map[string]any) { c["nbf"] = now.Add(time.Hour).Unix() }},
+		{name: "nbf within skew", change: func(c map[string]any) { c["nbf"] = now.Add(30 * time.Second).Unix() }, ok: true},
+		{name: "nbf past skew", change: func(c map[string]any) { c["nbf"] = now.Add(31 * time.Second).Unix() }},
+		{name: "wrong issuer", change: func(c map[string]any) { c["iss"] = "someone-else" }},
+		{name: "missing issuer", change: func(c map[string]any) { delete(c, "iss") }},
+		{name: "audience array", change: func(c map[string]any) { c["aud"] = []string{"movies-web", "movies-api"} }, ok: true},
+		{name: "wrong audience", change: func(c map[string]any) { c["aud"] = "movies-web" }},
+		{name: "wrong audience array", change: func(c map[string]any) { c["aud"] = []string{"movies-web"} }},
+		{name: "malformed audience", change: func(c map[string]any) { c["aud"] = 1 }},
+		{name: "subject is not a user id", change: func(c map[string]any) { c["sub"] = "alice" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims(now)
+			tt.change(claims)
+			token := signJWT(t, "ES256", "k1", key, claims)
+
+			user, err := v.Verify(context.Background(), token)
+			if !tt.ok {
+				if !errors.Is(err, storage.ErrInvalidToken) {
+					t.Fatalf("Verify error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if user.ID != 42 || !user.Activated || len(user.Permissions) != 1 || user.Permissions[0] != "movies:read" {
+				t.Fatalf("Verify user = %+v", user)
+			}
+		})
+	}
+}
+
+func TestJWTVerifySignature(t *testing.T) {
+	clk := newClock()
+	rsaKey := testRSAKey()
+	p256 := newECKey(t, elliptic.P256())
+	p384 := newECKey(t, elliptic.P384())
+	jwks := newJWKSServer(t, jwksJSON(t,
+		testKey{kid: "rsa", priv: rsaKey},
+		testKey{kid: "rsa-rs256", alg: "RS256", priv: rsaKey},
+		testKey{kid: "p256", priv: p256},
+		testKey{kid: "p384", priv: p384},
+	))
+	v := newTestVerifier(t, JWTOptions{JWKSURL: jwks.URL}, clk)
+	claims := testClaims(clk.Now())
+
+	truncate := func(sig []byte) []byte { return sig[:len(sig)-1] }
+	extend := func(sig []byte) []byte { return append(sig, 0) }
+
+	tests := []struct {
+		name   string
+		alg    string
+		kid    string
+		priv   crypto.Signer
+		change func(sig []byte) []byte
+		ok     bool
+	}{
+		{name: "RS256", alg: "RS256", kid: "rsa", priv: rsaKey, ok: true},
+		{name: "RS512", alg: "RS512", kid: "rsa", priv: rsaKey, ok: true},
+		{name: "ES256", alg: "ES256", kid: "p256", priv: p256, ok: true},
+		{name: "ES384", alg: "ES384", kid: "p384", priv: p384, ok: true},
+		{name: "RS256 on an EC key", alg: "RS256", kid: "p256", priv: p256},
+		{name: "ES256 on an RSA key", alg: "ES256", kid: "rsa", priv: rsaKey},
+		{name: "ES384 on a P-256 key", alg: "ES384", kid: "p256", priv: p256},
+		{name: "ES256 on a P-384 key", alg: "ES256", kid: "p384", priv: p384},
+		{name: "HS256 on an RSA key", alg: "HS256", kid: "rsa", priv: rsaKey},
+		{name: "none", alg: "none", kid: "rsa"},
+		{name: "none on an EC key", alg: "none", kid: "p256"},
+		{name: "alg the key does not publish", alg: "RS512", kid: "rsa-rs256", priv: rsaKey},
+		{name: "signed by another key", alg: "ES256", kid: "p256", priv: newECKey(t, elliptic.P256())},
+		{name: "truncated ECDSA signature", alg: "ES256", kid: "p256", priv: p256, change: truncate},
+		{name: "oversized ECDSA signature", alg: "ES256", kid: "p256", priv: p256, change: extend},
+		{name: "truncated RSA signature", alg: "RS256", kid: "rsa", priv: rsaKey, change: truncate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signJWT(t, tt.alg, tt.kid, tt.priv, claims)
+			if tt.change != nil {
+				token = withSignature(t, token, tt.change)
+			}
+
+			_, err := v.Verify(context.Background(), token)
+			if tt.ok && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, storage.ErrInvalidToken) {
+				t.Fatalf("Verify error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestJWTPublicKeyFile(t *testing.T) {
+	clk := newClock()
+	key := newECKey(t, elliptic.P256())
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	writeFile(t, path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	v := newTestVerifier(t, JWTOptions{PublicKeyFile: path}, clk)
+	claims := testClaims(clk.Now())
+
+	// A PEM key has no kid, so it is used whatever kid the token names.
+	for _, kid := range []string{"", "any"} {
+		_, err := v.Verify(context.Background(), signJWT(t, "ES256", kid, key, claims))
+		if err != nil {
+			t.Fatalf("Verify with kid %q: %v", kid, err)
+		}
+	}
+
+	_, err = v.Verify(context.Background(), signJWT(t, "ES256", "", newECKey(t, elliptic.P256()), claims))
+	if !errors.Is(err, storage.ErrInvalidToken) {
+		t.Fatalf("Verify with another key error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWTUnknownKidRefetchesOnce(t *testing.T) {
+	clk := newClock()
+	k1 := testKey{kid: "k1", priv: newECKey(t, elliptic.P256())}
+	k2 := testKey{kid: "k2", priv: newECKey(t, elliptic.P256())}
+	jwks := newJWKSServer(t, jwksJSON(t, k1))
+	v := newTestVerifier(t, JWTOptions{JWKSURL: jwks.URL}, clk)
+
+	clk.Advance(minKeyRefresh)
+	jwks.set(http.StatusOK, jwksJSON(t, k1, k2))
+	token := signJWT(t, "ES256", k2.kid, k2.priv, testClaims(clk.Now()))
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.Verify(context.Background(), token)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+	}
+	if got := jwks.fetches.Load(); got != 2 {
+		t.Fatalf("fetches = %d, want 2", got)
+	}
+
+	unknown := signJWT(t, "ES256", "k3", k2.priv, testClaims(clk.Now()))
+	for range 3 {
+		_, err := v.Verify(context.Background(), unknown)
+		if !errors.Is(err, storage.ErrInvalidToken) {
+			t.Fatalf("Verify error = %v, want ErrInvalidToken", err)
+		}
+	}
+	if got := jwks.fetches.Load(); got != 2 {
+		t.Fatalf("fetches after unknown kids = %d, want 2", got)
+	}
+
+	clk.Advance(minKeyRefresh)
+	v.Verify(context.Background(), unknown)
+	if got := jwks.fetches.Load(); got != 3 {
+		t.Fatalf("fetches once the limit passed = %d, want 3", got)
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	clk := newClock()
+	k1 := testKey{kid: "k1", priv: newECKey(t, elliptic.P256())}
+	k2 := testKey{kid: "k2", priv: newECKey(t, elliptic.P256())}
+	jwks := newJWKSServer(t, jwksJSON(t, k1))
+	v := newTestVerifier(t, JWTOptions{JWKSURL: jwks.URL}, clk)
+
+	old := signJWT(t, "ES256", k1.kid, k1.priv, testClaims(clk.Now()))
+	_, err := v.Verify(context.Background(), old)
+	if err != nil {
+		t.Fatalf("Verify with k1: %v", err)
+	}
+
+	clk.Advance(minKeyRefresh)
+	jwks.set(http.StatusOK, jwksJSON(t, k2))
+
+	// The refetch runs detached from the request, so a caller that is
+	// already gone does not leave the keys unrefreshed for everyone.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = v.Verify(ctx, signJWT(t, "ES256", k2.kid, k2.priv, testClaims(clk.Now())))
+	if err != nil {
+		t.Fatalf("Verify with k2: %v", err)
+	}
+
+	_, err = v.Verify(context.Background(), old)
+	if !errors.Is(err, storage.ErrInvalidToken) {
+		t.Fatalf("Verify with retired k1 error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWTKeepsKeysWhenRefetchFails(t *testing.T) {
+	clk := newClock()
+	k1 := testKey{kid: "k1", priv: newECKey(t, elliptic.P256())}
+	jwks := newJWKSServer(t, jwksJSON(t, k1))
+	v := newTestVerifier(t, JWTOptions{JWKSURL: jwks.URL}, clk)
+
+	clk.Advance(minKeyRefresh)
+	jwks.set(http.StatusInternalServerError, nil)
+	claims := testClaims(clk.Now())
+
+	_, err := v.Verify(context.Background(), signJWT(t, "ES256", "k2", k1.priv, claims))
+	if !errors.Is(err, storage.ErrInvalidToken) {
+		t.Fatalf("Verify with unknown kid error = %v, want ErrInvalidToken", err)
+	}
+	_, err = v.Verify(context.Background(), signJWT(t, "ES256", k1.kid, k1.priv, claims))
+	if err != nil {
+		t.Fatalf("Verify with k1 after a failed refetch: %v", err)
+	}
+}
+
+func TestJWTWithoutKeys(t *testing.T) {
+	clk := newClock()
+	jwks := newJWKSServer(t, nil)
+	jwks.set(http.StatusInternalServerError, nil)
+
+	v := NewJWTVerifier(newTestLogger(), JWTOptions{JWKSURL: jwks.URL})
+	v.now = clk.Now
+	if err := v.Start(); err == nil {
+		t.Fatal("Start succeeded without keys")
+	}
+
+	key := newECKey(t, elliptic.P256())
+	_, err := v.Verify(context.Background(), signJWT(t, "ES256", "k1", key, testClaims(clk.Now())))
+	if !errors.Is(err, storage.ErrAuthUnavailable) {
+		t.Fatalf("Verify error = %v, want ErrAuthUnavailable", err)
+	}
+}
+
+func TestJWTStartNeedsOneKeySource(t *testing.T) {
+	tests := []struct {
+		name string
+		opts JWTOptions
+	}{
+		{name: "none", opts: JWTOptions{}},
+		{name: "two", opts: JWTOptions{PublicKeyFile: "jwt.pem", JWKSURL: "http://localhost/jwks.json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewJWTVerifier(newTestLogger(), tt.opts).Start()
+			if err == nil {
+				t.Fatal("Start succeeded")
+			}
+		})
+	}
+}
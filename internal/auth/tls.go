@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/AndreyChufelin/movies-api/internal/logger"
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSOptions configure the connection to movies-auth. CertFile and KeyFile
+// turn on mTLS; an empty CAFile trusts the system roots.
+type TLSOptions struct {
+	Enabled    bool
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+}
+
+// tlsReloader keeps the CA bundle and client certificate in memory and
+// reloads them when the files change, so rotated certificates are picked up
+// by new connections without a restart.
+type tlsReloader struct {
+	logger  *logger.Logger
+	opts    TLSOptions
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+
+	mu   sync.RWMutex
+	pool *x509.CertPool
+	cert *tls.Certificate
+}
+
+func newTLSReloader(log *logger.Logger, opts TLSOptions) (*tlsReloader, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("cert_file and key_file must be set together")
+	}
+
+	r := &tlsReloader{
+		logger: log,
+		opts:   opts,
+		done:   make(chan struct{}),
+	}
+	err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *tlsReloader) load() error {
+	var pool *x509.CertPool
+	if r.opts.CAFile != "" {
+		pem, err := os.ReadFile(r.opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read ca file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.opts.CAFile)
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.opts.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cert = &c
+	}
+
+	r.mu.Lock()
+	r.pool = pool
+	r.cert = cert
+	r.mu.Unlock()
+
+	return nil
+}
+
+// credentials returns transport credentials that take the current CA pool
+// and client certificate for every new connection.
+func (r *tlsReloader) credentials() credentials.TransportCredentials {
+	return &reloadingCredentials{reloader: r}
+}
+
+// current builds the TLS credentials for the files loaded last. The standard
+// verification runs on them, including the server name gRPC derives from
+// the target when ServerName is empty.
+func (r *tlsReloader) current() credentials.TransportCredentials {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: r.opts.ServerName,
+		RootCAs:    r.pool,
+	}
+	if r.cert != nil {
+		cert := r.cert
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
+		}
+	}
+
+	return credentials.NewTLS(cfg)
+}
+
+type reloadingCredentials struct {
+	reloader *tlsReloader
+}
+
+func (c *reloadingCredentials) ClientHandshake(
+	ctx context.Context,
+	authority string,
+	conn net.Conn,
+) (net.Conn, credentials.AuthInfo, error) {
+	return c.reloader.current().ClientHandshake(ctx, authority, conn)
+}
+
+func (c *reloadingCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("auth credentials are client only")
+}
+
+func (c *reloadingCredentials) Info() credentials.ProtocolInfo {
+	return c.reloader.current().Info()
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{reloader: c.reloader}
+}
+
+func (c *reloadingCredentials) OverrideServerName(string) error {
+	return errors.New("set the server name in the auth options")
+}
+
+// watch reloads the files on change. Their directories are watched rather
+// than the files themselves, so editors and Kubernetes secret updates that
+// replace the file are seen too.
+func (r *tlsReloader) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create certificate watcher: %w", err)
+	}
+
+	dirs := make(map[string]struct{})
+	for _, file := range []string{r.opts.CAFile, r.opts.CertFile, r.opts.KeyFile} {
+		if file != "" {
+			dirs[filepath.Dir(file)] = struct{}{}
+		}
+	}
+	for dir := range dirs {
+		err = watcher.Add(dir)
+		if err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	r.watcher = watcher
+
+	go func() {
+		defer close(r.done)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+					continue
+				}
+				err := r.load()
+				if err != nil {
+					// A rotation may write the files one by one; keep the old
+					// ones until the set is consistent again.
+					r.logger.Warn("failed to reload auth certificates", "error", err)
+					continue
+				}
+				r.logger.Info("reloaded auth certificates", "file", event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				r.logger.Error("auth certificate watcher failed", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (r *tlsReloader) close() error {
+	if r.watcher == nil {
+		return nil
+	}
+	err := r.watcher.Close()
+	<-r.done
+	return err
+}
@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/auth/fake"
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	pbuser "github.com/AndreyChufelin/movies-auth/pkg/pb/user"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var serialNumber int64
+
+func newSerial() *big.Int {
+	serialNumber++
+	return big.NewInt(serialNumber)
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM certificate and key for name signed by the CA.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: newSerial(),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	err := os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTLSUserService serves a fake UserService that knows "token" over
+// TLS with a certificate for "auth.test". With clientCA set it requires a
+// client certificate signed by it.
+func startTLSUserService(t *testing.T, ca, clientCA *testCA) string {
+	t.Helper()
+
+	certPEM, keyPEM := ca.issue(t, "auth.test", x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCA != nil {
+		cfg.ClientCAs = x509.NewCertPool()
+		cfg.ClientCAs.AddCert(clientCA.cert)
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	svc, err := fake.NewUserService(&fake.Fixture{Users: []fake.User{
+		{ID: 42, Activated: true, Permissions: []string{"movies:read"}, Tokens: []string{"token"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(cfg)))
+	pbuser.RegisterUserServiceServer(srv, svc)
+	go srv.Serve(lis) //nolint:errcheck // stopped below
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+func startTLSAuth(t *testing.T, addr string, opts TLSOptions) *Auth {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Enabled = true
+	a := NewAuth(newTestLogger(), host, port, Options{CallTimeout: 5 * time.Second, TLS: opts})
+	err = a.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+
+	return a
+}
+
+type tlsFiles struct {
+	dir  string
+	ca   string
+	cert string
+	key  string
+}
+
+func newTLSFiles(t *testing.T, ca *testCA) tlsFiles {
+	t.Helper()
+
+	dir := t.TempDir()
+	f := tlsFiles{
+		dir:  dir,
+		ca:   filepath.Join(dir, "ca.pem"),
+		cert: filepath.Join(dir, "client.pem"),
+		key:  filepath.Join(dir, "client-key.pem"),
+	}
+	writeFile(t, f.ca, ca.pem)
+	return f
+}
+
+func (f tlsFiles) writeClientCert(t *testing.T, certPEM, keyPEM []byte) {
+	t.Helper()
+
+	writeFile(t, f.key, keyPEM)
+	writeFile(t, f.cert, certPEM)
+}
+
+func TestTLSVerifyToken(t *testing.T) {
+	ca := newTestCA(t, "test ca")
+	other := newTestCA(t, "other ca")
+	clientCert, clientKey := ca.issue(t, "movies-api", x509.ExtKeyUsageClientAuth)
+	rogueCert, rogueKey := other.issue(t, "movies-api", x509.ExtKeyUsageClientAuth)
+
+	tlsAddr := startTLSUserService(t, ca, nil)
+	mtlsAddr := startTLSUserService(t, ca, ca)
+
+	tests := []struct {
+		name       string
+		addr       string
+		ca         *testCA
+		serverName string
+		cert, key  []byte
+		ok         bool
+	}{
+		{name: "tls", addr: tlsAddr, ca: ca, serverName: "auth.test", ok: true},
+		{name: "tls with client cert", addr: tlsAddr, ca: ca, serverName: "auth.test", cert: clientCert, key: clientKey, ok: true},
+		{name: "wrong ca", addr: tlsAddr, ca: other, serverName: "auth.test"},
+		{name: "wrong server name", addr: tlsAddr, ca: ca, serverName: "other.test"},
+		{name: "server name from target", addr: tlsAddr, ca: ca},
+		{name: "mtls", addr: mtlsAddr, ca: ca, serverName: "auth.test", cert: clientCert, key: clientKey, ok: true},
+		{name: "mtls without client cert", addr: mtlsAddr, ca: ca, serverName: "auth.test"},
+		{name: "mtls with untrusted client cert", addr: mtlsAddr, ca: ca, serverName: "auth.test", cert: rogueCert, key: rogueKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := newTLSFiles(t, tt.ca)
+			opts := TLSOptions{CAFile: files.ca, ServerName: tt.serverName}
+			if tt.cert != nil {
+				files.writeClientCert(t, tt.cert, tt.key)
+				opts.CertFile, opts.KeyFile = files.cert, files.key
+			}
+			a := startTLSAuth(t, tt.addr, opts)
+
+			user, err := a.Verify(context.Background(), "token")
+			if !tt.ok {
+				if !errors.Is(err, storage.ErrAuthUnavailable) {
+					t.Fatalf("Verify error = %v, want ErrAuthUnavailable", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if user.ID != 42 || !user.Activated {
+				t.Fatalf("unexpected user %+v", user)
+			}
+			if _, err := a.Verify(context.Background(), "bogus"); !errors.Is(err, storage.ErrInvalidToken) {
+				t.Fatalf("Verify(bogus) error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+// eventuallyVerifies retries until a new connection picks up the rewritten
+// files; gRPC backs off between reconnects, so this may take a few seconds.
+func eventuallyVerifies(t *testing.T, a *Auth) {
+	t.Helper()
+
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		_, err := a.Verify(context.Background(), "token")
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Verify still fails after the files were rewritten: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestTLSReloadsClientCertificate(t *testing.T) {
+	ca := newTestCA(t, "test ca")
+	other := newTestCA(t, "other ca")
+	addr := startTLSUserService(t, ca, ca)
+
+	files := newTLSFiles(t, ca)
+	rogueCert, rogueKey := other.issue(t, "movies-api", x509.ExtKeyUsageClientAuth)
+	files.writeClientCert(t, rogueCert, rogueKey)
+	a := startTLSAuth(t, addr, TLSOptions{
+		CAFile:     files.ca,
+		CertFile:   files.cert,
+		KeyFile:    files.key,
+		ServerName: "auth.test",
+	})
+
+	if _, err := a.Verify(context.Background(), "token"); !errors.Is(err, storage.ErrAuthUnavailable) {
+		t.Fatalf("Verify with an untrusted client cert = %v, want ErrAuthUnavailable", err)
+	}
+
+	clientCert, clientKey := ca.issue(t, "movies-api", x509.ExtKeyUsageClientAuth)
+	files.writeClientCert(t, clientCert, clientKey)
+	eventuallyVerifies(t, a)
+}
+
+func TestTLSReloadsCA(t *testing.T) {
+	ca := newTestCA(t, "test ca")
+	other := newTestCA(t, "other ca")
+	addr := startTLSUserService(t, ca, nil)
+
+	files := newTLSFiles(t, other)
+	a := startTLSAuth(t, addr, TLSOptions{CAFile: files.ca, ServerName: "auth.test"})
+
+	if _, err := a.Verify(context.Background(), "token"); !errors.Is(err, storage.ErrAuthUnavailable) {
+		t.Fatalf("Verify with the wrong CA = %v, want ErrAuthUnavailable", err)
+	}
+
+	writeFile(t, files.ca, ca.pem)
+	eventuallyVerifies(t, a)
+}
+
+func TestTLSReloaderKeepsKeysOnBadRewrite(t *testing.T) {
+	ca := newTestCA(t, "test ca")
+	files := newTLSFiles(t, ca)
+	clientCert, clientKey := ca.issue(t, "movies-api", x509.ExtKeyUsageClientAuth)
+	files.writeClientCert(t, clientCert, clientKey)
+
+	r, err := newTLSReloader(newTestLogger(), TLSOptions{CAFile: files.ca, CertFile: files.cert, KeyFile: files.key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := r.cert
+
+	writeFile(t, files.cert, []byte("not a certificate"))
+	if err := r.load(); err == nil {
+		t.Fatal("load accepted a broken certificate")
+	}
+	if r.cert != before {
+		t.Fatal("a failed reload replaced the certificate")
+	}
+}
+
+func TestTLSReloaderOptions(t *testing.T) {
+	ca := newTestCA(t, "test ca")
+	files := newTLSFiles(t, ca)
+
+	if _, err := newTLSReloader(newTestLogger(), TLSOptions{CAFile: files.ca, CertFile: files.cert}); err == nil {
+		t.Fatal("cert_file without key_file was accepted")
+	}
+	if _, err := newTLSReloader(newTestLogger(), TLSOptions{CAFile: filepath.Join(files.dir, "missing.pem")}); err == nil {
+		t.Fatal("missing ca_file was accepted")
+	}
+	writeFile(t, files.ca, []byte("garbage"))
+	if _, err := newTLSReloader(newTestLogger(), TLSOptions{CAFile: files.ca}); err == nil {
+		t.Fatal("ca_file without certificates was accepted")
+	}
+}
@@ -10,18 +10,28 @@ import (
 
 type Config struct {
 	REST        RESTConf
+	Storage     StorageConf
 	DB          DBConf
 	RateLimiter RateLimiterConf
 	Auth        AuthConf
 	CORS        CORSConfig
+	Idempotency IdempotencyConf
+	Trash       TrashConf
 }
 
 type RESTConf struct {
-	Host         string
-	Port         string
-	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
-	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	Host          string
+	Port          string
+	IdleTimeout   time.Duration            `mapstructure:"idle_timeout"`
+	ReadTimeout   time.Duration            `mapstructure:"read_timeout"`
+	WriteTimeout  time.Duration            `mapstructure:"write_timeout"`
+	QueryTimeout  time.Duration            `mapstructure:"query_timeout"`
+	RouteTimeouts map[string]time.Duration `mapstructure:"route_timeouts"`
+	LegacyErrors  bool                     `mapstructure:"legacy_errors"`
+}
+
+type StorageConf struct {
+	Driver string
 }
 
 type DBConf struct {
@@ -31,8 +41,18 @@ type DBConf struct {
 	Host         string
 	Port         string
 	MaxOpenConns int           `mapstructure:"max_open_conns"`
-	MaxIdleConns int           `mapstructure:"max_idle_conns"`
 	MaxIdleTime  time.Duration `mapstructure:"max_idle_time"`
+	// Deprecated: pgxpool has no cap on idle connections, so this is
+	// ignored; idle connections are bounded by MaxIdleTime.
+	MaxIdleConns int `mapstructure:"max_idle_conns"`
+
+	SSLMode           string        `mapstructure:"sslmode"`
+	SSLRootCert       string        `mapstructure:"sslrootcert"`
+	StatementTimeout  time.Duration `mapstructure:"statement_timeout"`
+	ApplicationName   string        `mapstructure:"application_name"`
+	HealthCheckPeriod time.Duration `mapstructure:"health_check_period"`
+	ConnectRetries    int           `mapstructure:"connect_retries"`
+	ConnectBackoff    time.Duration `mapstructure:"connect_backoff"`
 }
 
 type RateLimiterConf struct {
@@ -41,14 +61,55 @@ type RateLimiterConf struct {
 }
 
 type AuthConf struct {
-	Host string
-	Port string
+	Mode        string
+	Host        string
+	Port        string
+	CacheSize   int           `mapstructure:"cache_size"`
+	CacheTTL    time.Duration `mapstructure:"cache_ttl"`
+	NegativeTTL time.Duration `mapstructure:"negative_ttl"`
+
+	CallTimeout      time.Duration `mapstructure:"call_timeout"`
+	MaxRetries       int           `mapstructure:"max_retries"`
+	RetryBackoff     time.Duration `mapstructure:"retry_backoff"`
+	BreakerThreshold int           `mapstructure:"breaker_threshold"`
+	BreakerCooldown  time.Duration `mapstructure:"breaker_cooldown"`
+	DegradedMode     string        `mapstructure:"degraded_mode"`
+
+	TLS        bool
+	CAFile     string `mapstructure:"ca_file"`
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	ServerName string `mapstructure:"server_name"`
+
+	JWT JWTConf
+
+	Fixture string
+}
+
+type JWTConf struct {
+	PublicKeyFile   string        `mapstructure:"public_key_file"`
+	JWKSFile        string        `mapstructure:"jwks_file"`
+	JWKSURL         string        `mapstructure:"jwks_url"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	Issuer          string
+	Audience        string
+	ClockSkew       time.Duration `mapstructure:"clock_skew"`
 }
 
 type CORSConfig struct {
 	Origins []string
 }
 
+type IdempotencyConf struct {
+	TTL           time.Duration
+	SweepInterval time.Duration `mapstructure:"sweep_interval"`
+}
+
+type TrashConf struct {
+	RetentionDays int           `mapstructure:"retention_days"`
+	SweepInterval time.Duration `mapstructure:"sweep_interval"`
+}
+
 func LoadConfig(path string) (Config, error) {
 	viper.SetConfigFile(path)
 
@@ -67,3 +128,13 @@ func LoadConfig(path string) (Config, error) {
 
 	return config, nil
 }
+
+// Deprecations describes the settings in use that are still accepted but
+// have no effect any more, for the caller to log at startup.
+func (c Config) Deprecations() []string {
+	var msgs []string
+	if c.DB.MaxIdleConns != 0 {
+		msgs = append(msgs, "db.max_idle_conns is deprecated and ignored, idle connections are bounded by db.max_idle_time")
+	}
+	return msgs
+}
@@ -0,0 +1,294 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/AndreyChufelin/movies-api/pkg/validator"
+)
+
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+
+	// GenresSeparator splits the genres column of CSV files, matching the
+	// CSV export of the API.
+	GenresSeparator = "|"
+
+	maxExternalIDLen = 255
+)
+
+var csvColumns = []string{"external_id", "title", "year", "runtime", "genres"}
+
+// LineError reports why the record on Line was skipped.
+type LineError struct {
+	Line    int
+	Field   string
+	Message string
+}
+
+func (e LineError) String() string {
+	if e.Field == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+}
+
+type record struct {
+	ExternalID string          `json:"external_id"`
+	Title      string          `json:"title"`
+	Year       int32           `json:"year"`
+	Runtime    storage.Runtime `json:"runtime"`
+	Genres     []string        `json:"genres"`
+}
+
+type Importer struct {
+	validator *validator.Validator
+}
+
+func NewImporter() (*Importer, error) {
+	v, err := validator.NewValidator()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator: %w", err)
+	}
+
+	return &Importer{validator: v}, nil
+}
+
+// Read parses and validates every record in r. Invalid records, and records
+// repeating an external_id seen earlier in the file, are reported as line
+// errors instead of failing the whole read.
+func (im *Importer) Read(r io.Reader, format string) ([]storage.ImportRecord, []LineError, error) {
+	var records []storage.ImportRecord
+	var lineErrs []LineError
+	seen := make(map[string]int)
+
+	add := func(line int, rec record) {
+		errs := im.validate(line, rec)
+		if first, ok := seen[rec.ExternalID]; ok && rec.ExternalID != "" {
+			errs = append(errs, LineError{
+				Line:    line,
+				Field:   "external_id",
+				Message: fmt.Sprintf("duplicate of line %d", first),
+			})
+		}
+		if len(errs) > 0 {
+			lineErrs = append(lineErrs, errs...)
+			return
+		}
+
+		seen[rec.ExternalID] = line
+		records = append(records, storage.ImportRecord{
+			ExternalID: rec.ExternalID,
+			Movie: storage.Movie{
+				Title:   rec.Title,
+				Year:    rec.Year,
+				Runtime: rec.Runtime,
+				Genres:  rec.Genres,
+			},
+		})
+	}
+	fail := func(lineErr LineError) {
+		lineErrs = append(lineErrs, lineErr)
+	}
+
+	var err error
+	switch format {
+	case FormatNDJSON:
+		err = readNDJSON(r, add, fail)
+	case FormatCSV:
+		err = readCSV(r, add, fail)
+	default:
+		return nil, nil, fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return records, lineErrs, nil
+}
+
+// Store is where Import writes the valid records.
+type Store interface {
+	ImportMovies(ctx context.Context, records []storage.ImportRecord) (storage.ImportStats, error)
+}
+
+// Import writes records to the store returned by open. For a dry run, or
+// when there is nothing to write, open is never called and Import returns
+// nil stats, so the database is not touched.
+func Import(
+	ctx context.Context,
+	open func(context.Context) (Store, error),
+	records []storage.ImportRecord,
+	dryRun bool,
+) (*storage.ImportStats, error) {
+	if dryRun || len(records) == 0 {
+		return nil, nil
+	}
+
+	store, err := open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := store.ImportMovies(ctx, records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import movies: %w", err)
+	}
+
+	return &stats, nil
+}
+
+// WriteReport writes one line error per line to w.
+func WriteReport(w io.Writer, lineErrs []LineError) error {
+	for _, lineErr := range lineErrs {
+		if _, err := fmt.Fprintln(w, lineErr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (im *Importer) validate(line int, rec record) []LineError {
+	var errs []LineError
+	switch {
+	case rec.ExternalID == "":
+		errs = append(errs, LineError{Line: line, Field: "external_id", Message: "external_id is a required field"})
+	case len(rec.ExternalID) > maxExternalIDLen:
+		errs = append(errs, LineError{Line: line, Field: "external_id", Message: "external_id is too long"})
+	}
+
+	movie := storage.Movie{
+		Title:   rec.Title,
+		Year:    rec.Year,
+		Runtime: rec.Runtime,
+		Genres:  rec.Genres,
+	}
+	err := im.validator.Validate(movie)
+	var validationErrs *validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		for _, verr := range validationErrs.Errors {
+			errs = append(errs, LineError{
+				Line:    line,
+				Field:   strings.TrimPrefix(verr.Pointer, "/"),
+				Message: verr.Message,
+			})
+		}
+	}
+
+	return errs
+}
+
+func readNDJSON(r io.Reader, add func(int, record), fail func(LineError)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			fail(jsonLineError(line, err))
+			continue
+		}
+		add(line, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read ndjson: %w", err)
+	}
+
+	return nil
+}
+
+func jsonLineError(line int, err error) LineError {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		return LineError{Line: line, Field: typeErr.Field, Message: "invalid value"}
+	case errors.Is(err, storage.ErrInvalidRuntimeFormat):
+		return LineError{Line: line, Field: "runtime", Message: "invalid value"}
+	default:
+		return LineError{Line: line, Message: "invalid json"}
+	}
+}
+
+func readCSV(r io.Reader, add func(int, record), fail func(LineError)) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read csv header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("csv header is missing column %q", name)
+		}
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				fail(LineError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return fmt.Errorf("failed to read csv: %w", err)
+		}
+		// FieldPos is only valid after a successful Read.
+		line, _ := reader.FieldPos(0)
+		if len(row) != len(header) {
+			fail(LineError{Line: line, Message: "wrong number of fields"})
+			continue
+		}
+
+		value := func(name string) string {
+			return strings.TrimSpace(row[columns[name]])
+		}
+		rec := record{
+			ExternalID: value("external_id"),
+			Title:      value("title"),
+		}
+
+		year, err := strconv.ParseInt(value("year"), 10, 32)
+		if err != nil {
+			fail(LineError{Line: line, Field: "year", Message: "invalid value"})
+			continue
+		}
+		rec.Year = int32(year)
+
+		rec.Runtime, err = storage.ParseRuntime(value("runtime"))
+		if err != nil {
+			fail(LineError{Line: line, Field: "runtime", Message: "invalid value"})
+			continue
+		}
+
+		if genres := value("genres"); genres != "" {
+			rec.Genres = strings.Split(genres, GenresSeparator)
+		}
+
+		add(line, rec)
+	}
+}
@@ -0,0 +1,268 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/AndreyChufelin/movies-api/internal/storage/memory"
+)
+
+func newTestImporter(t *testing.T) *Importer {
+	t.Helper()
+
+	im, err := NewImporter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return im
+}
+
+// lineField is the part of a LineError the tests compare: where it is and
+// which field it is about.
+type lineField struct {
+	line  int
+	field string
+}
+
+func assertLineErrors(t *testing.T, got []LineError, want []lineField) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("line errors = %v, want %v", got, want)
+	}
+	for i, lineErr := range got {
+		if lineErr.Line != want[i].line || lineErr.Field != want[i].field {
+			t.Fatalf("line error %d = %v, want line %d field %q", i, lineErr, want[i].line, want[i].field)
+		}
+	}
+}
+
+func assertExternalIDs(t *testing.T, records []storage.ImportRecord, want ...string) {
+	t.Helper()
+
+	var got []string
+	for _, rec := range records {
+		got = append(got, rec.ExternalID)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("records = %v, want %v", got, want)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	input := strings.Join([]string{
+		"external_id,title,year,runtime,genres",
+		"tt1,Moonlight,2016,111 mins,drama",
+		`x"y,Bare quote,2016,111 mins,drama`,
+		"tt2,Arrival,twenty,116 mins,sci-fi",
+		"tt3,Alien,1979,long,horror|sci-fi",
+		"tt4,Too few fields,1999",
+		"tt1,Moonlight again,2016,111 mins,drama",
+		",No external id,2000,90 mins,drama",
+		"tt5,,2000,90 mins,drama",
+		`"tt6","Quoted, with a comma",2001,100 mins,"drama|comedy"`,
+	}, "\n")
+
+	records, lineErrs, err := newTestImporter(t).Read(strings.NewReader(input), FormatCSV)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	assertExternalIDs(t, records, "tt1", "tt6")
+	if got := records[0].Movie; got.Title != "Moonlight" || got.Year != 2016 || got.Runtime != 111 ||
+		len(got.Genres) != 1 || got.Genres[0] != "drama" {
+		t.Fatalf("first record = %+v", got)
+	}
+	if got := records[1].Movie; got.Title != "Quoted, with a comma" || len(got.Genres) != 2 || got.Genres[1] != "comedy" {
+		t.Fatalf("quoted record = %+v", got)
+	}
+	assertLineErrors(t, lineErrs, []lineField{
+		{line: 3},
+		{line: 4, field: "year"},
+		{line: 5, field: "runtime"},
+		{line: 6},
+		{line: 7, field: "external_id"},
+		{line: 8, field: "external_id"},
+		{line: 9, field: "title"},
+	})
+}
+
+func TestReadCSVReportsLinesOfMultilineRecords(t *testing.T) {
+	input := strings.Join([]string{
+		"external_id,title,year,runtime,genres",
+		`tt1,"Two`,
+		`lines",2016,111 mins,drama`,
+		"tt2,Arrival,twenty,116 mins,sci-fi",
+	}, "\n")
+
+	records, lineErrs, err := newTestImporter(t).Read(strings.NewReader(input), FormatCSV)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	assertExternalIDs(t, records, "tt1")
+	assertLineErrors(t, lineErrs, []lineField{{line: 4, field: "year"}})
+}
+
+func TestReadCSVHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		ok    bool
+	}{
+		{name: "reordered columns", input: "genres, title ,external_id,runtime,year\ndrama,Moonlight,tt1,111 mins,2016", ok: true},
+		{name: "extra column", input: "external_id,title,year,runtime,genres,notes\ntt1,Moonlight,2016,111 mins,drama,", ok: true},
+		{name: "missing column", input: "external_id,title,year,genres\ntt1,Moonlight,2016,drama"},
+		{name: "empty file", input: ""},
+		{name: "malformed header", input: "external_id,\"title\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, _, err := newTestImporter(t).Read(strings.NewReader(tt.input), FormatCSV)
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("Read accepted the header")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			assertExternalIDs(t, records, "tt1")
+			if records[0].Movie.Title != "Moonlight" || records[0].Movie.Year != 2016 {
+				t.Fatalf("record = %+v", records[0].Movie)
+			}
+		})
+	}
+}
+
+func TestReadNDJSON(t *testing.T) {
+	input := strings.Join([]string{
+		`{"external_id":"tt1","title":"Moonlight","year":2016,"runtime":"111 mins","genres":["drama"]}`,
+		``,
+		`{"external_id":"tt2","title":"Arrival"`,
+		`{"external_id":"tt3","title":"Alien","year":"1979","runtime":"117 mins","genres":["horror"]}`,
+		`{"external_id":"tt4","title":"Heat","year":1995,"runtime":"long","genres":["crime"]}`,
+		`   `,
+		`{"external_id":"tt1","title":"Moonlight","year":2016,"runtime":"111 mins","genres":["drama"]}`,
+		`{"title":"No external id","year":2000,"runtime":"90 mins","genres":["drama"]}`,
+		`not json at all`,
+		`{"external_id":"tt5","title":"Paterson","year":2016,"runtime":"118 mins","genres":["drama"]}`,
+	}, "\n")
+
+	records, lineErrs, err := newTestImporter(t).Read(strings.NewReader(input), FormatNDJSON)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	assertExternalIDs(t, records, "tt1", "tt5")
+	assertLineErrors(t, lineErrs, []lineField{
+		{line: 3},
+		{line: 4, field: "year"},
+		{line: 5, field: "runtime"},
+		{line: 7, field: "external_id"},
+		{line: 8, field: "external_id"},
+		{line: 9},
+	})
+}
+
+func TestReadUnknownFormat(t *testing.T) {
+	_, _, err := newTestImporter(t).Read(strings.NewReader(""), "xml")
+	if err == nil {
+		t.Fatal("Read accepted an unknown format")
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	input := "external_id,title,year,runtime,genres\n" +
+		"tt1,Moonlight,2016,111 mins,drama\n" +
+		"tt2,Arrival,twenty,116 mins,sci-fi\n" +
+		`x"y,Bare quote,2016,111 mins,drama` + "\n"
+	_, lineErrs, err := newTestImporter(t).Read(strings.NewReader(input), FormatCSV)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = WriteReport(&buf, lineErrs)
+	if err != nil {
+		t.Fatalf("WriteReport: %v", err)
+	}
+	want := "line 3: year: invalid value\n" +
+		"line 4: " + `bare " in non-quoted-field` + "\n"
+	if buf.String() != want {
+		t.Fatalf("report = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	records := []storage.ImportRecord{{
+		ExternalID: "tt1",
+		Movie:      storage.Movie{Title: "Moonlight", Year: 2016, Runtime: 111, Genres: []string{"drama"}},
+	}}
+
+	tests := []struct {
+		name    string
+		records []storage.ImportRecord
+		dryRun  bool
+		write   bool
+	}{
+		{name: "import", records: records, write: true},
+		{name: "dry run", records: records, dryRun: true},
+		{name: "nothing to import", records: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStorage()
+			opened := false
+			open := func(context.Context) (Store, error) {
+				opened = true
+				return db, nil
+			}
+
+			stats, err := Import(ctx, open, tt.records, tt.dryRun)
+			if err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if opened != tt.write {
+				t.Fatalf("store opened = %v, want %v", opened, tt.write)
+			}
+			if !tt.write {
+				if stats != nil {
+					t.Fatalf("stats = %+v, want none", stats)
+				}
+				return
+			}
+			if stats == nil || *stats != (storage.ImportStats{Inserted: 1}) {
+				t.Fatalf("stats = %+v", stats)
+			}
+			// The records are in the store now, so importing them again
+			// changes nothing.
+			again, err := db.ImportMovies(ctx, tt.records)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != (storage.ImportStats{Unchanged: 1}) {
+				t.Fatalf("second import stats = %+v", again)
+			}
+		})
+	}
+}
+
+func TestImportOpenError(t *testing.T) {
+	errOpen := errors.New("no database")
+	records := []storage.ImportRecord{{ExternalID: "tt1"}}
+	open := func(context.Context) (Store, error) { return nil, errOpen }
+
+	_, err := Import(context.Background(), open, records, false)
+	if !errors.Is(err, errOpen) {
+		t.Fatalf("Import error = %v, want %v", err, errOpen)
+	}
+}
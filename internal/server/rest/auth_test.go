@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/auth"
+	"github.com/AndreyChufelin/movies-api/internal/auth/fake"
+)
+
+// newFakeAuth returns an auth.Auth that verifies tokens over gRPC with a
+// fake movies-auth serving the development fixture in memory.
+func newFakeAuth(t *testing.T) *auth.Auth {
+	t.Helper()
+
+	fixture, err := fake.LoadFixture("../../../configs/auth-fixture.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := fake.NewUserService(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := fake.NewBufconn(svc)
+	t.Cleanup(srv.Close)
+
+	a := auth.NewAuth(newTestLogger(), "bufnet", "0", auth.Options{
+		Dialer:      srv.Dial,
+		CallTimeout: time.Second,
+	})
+	err = a.Start()
+	if err != nil {
+		t.Fatalf("failed to start auth: %v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func TestFixtureUsersThroughAuth(t *testing.T) {
+	e := newTestServer(t, newFakeAuth(t))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		status int
+		code   string
+	}{
+		{
+			name:   "missing token",
+			method: http.MethodGet,
+			target: "/v1/movies",
+			status: http.StatusUnauthorized,
+			code:   codeAuthenticationRequired,
+		},
+		{
+			name:   "unknown token",
+			method: http.MethodGet,
+			target: "/v1/movies",
+			token:  "unknown-token",
+			status: http.StatusUnauthorized,
+			code:   codeInvalidToken,
+		},
+		{
+			name:   "inactive user",
+			method: http.MethodGet,
+			target: "/v1/movies",
+			token:  "inactive-token",
+			status: http.StatusForbidden,
+			code:   codeAccountNotActivated,
+		},
+		{
+			name:   "reader without movies:write",
+			method: http.MethodGet,
+			target: "/v1/movies/trash",
+			token:  "reader-token",
+			status: http.StatusForbidden,
+			code:   codePermissionDenied,
+		},
+		{
+			name:   "moderator without movies:export",
+			method: http.MethodGet,
+			target: "/v1/movies/export",
+			token:  "moderator-token",
+			status: http.StatusForbidden,
+			code:   codePermissionDenied,
+		},
+		{
+			name:   "reader without reviews:moderate",
+			method: http.MethodGet,
+			target: "/v1/reviews",
+			token:  "reader-token",
+			status: http.StatusForbidden,
+			code:   codePermissionDenied,
+		},
+		{
+			name:   "admin",
+			method: http.MethodGet,
+			target: "/v1/movies/trash",
+			token:  "admin-token",
+			status: http.StatusOK,
+		},
+		{
+			name:   "reader",
+			method: http.MethodGet,
+			target: "/v1/movies",
+			token:  "reader-token",
+			status: http.StatusOK,
+		},
+		{
+			name:   "moderator",
+			method: http.MethodGet,
+			target: "/v1/reviews",
+			token:  "moderator-token",
+			status: http.StatusOK,
+		},
+		{
+			// An inactive user may still use the routes open to everyone.
+			name:   "inactive user on a public route",
+			method: http.MethodGet,
+			target: "/v1/users/4/lists",
+			token:  "inactive-token",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: tt.method, target: tt.target, token: tt.token})
+			assertStatus(t, rec, tt.status)
+			if tt.code != "" {
+				assertCode(t, rec, tt.code)
+			}
+		})
+	}
+}
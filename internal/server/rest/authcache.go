@@ -0,0 +1,61 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TokenInvalidator is implemented by authenticators that cache verified
+// tokens. The cache routes are only mounted when the authenticator has one.
+type TokenInvalidator interface {
+	Invalidate(token string)
+	InvalidateUser(id int64) int
+	InvalidateAll()
+}
+
+// invalidateOwnTokenHandler drops the caller's token, so a client that
+// logged out of movies-auth is not let in again from the cache.
+func (s *Server) invalidateOwnTokenHandler(c echo.Context) error {
+	log := s.log.With("handler", "invalidate own token")
+	invalidator := s.auth.(TokenInvalidator)
+
+	token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	invalidator.Invalidate(token)
+	log.Info("invalidated cached token", "user_id", (&AuthContext{c}).GetUser().ID)
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "token successfully invalidated",
+	})
+}
+
+func (s *Server) invalidateUserTokensHandler(c echo.Context) error {
+	log := s.log.With("handler", "invalidate user tokens")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	invalidated := s.auth.(TokenInvalidator).InvalidateUser(id)
+	log.Info("invalidated cached tokens", "user_id", id, "tokens", invalidated)
+
+	return c.JSON(http.StatusOK, envelope{
+		"invalidated": invalidated,
+	})
+}
+
+func (s *Server) invalidateAllTokensHandler(c echo.Context) error {
+	log := s.log.With("handler", "invalidate all tokens")
+
+	s.auth.(TokenInvalidator).InvalidateAll()
+	log.Info("invalidated all cached tokens")
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "token cache successfully cleared",
+	})
+}
@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+)
+
+// cachingAuth records the invalidations it is asked for.
+type cachingAuth struct {
+	staticAuth
+	tokens []string
+	users  []int64
+	all    int
+}
+
+func (a *cachingAuth) Invalidate(token string) { a.tokens = append(a.tokens, token) }
+
+func (a *cachingAuth) InvalidateUser(id int64) int {
+	a.users = append(a.users, id)
+	return 2
+}
+
+func (a *cachingAuth) InvalidateAll() { a.all++ }
+
+func TestTokenCacheRoutes(t *testing.T) {
+	auth := &cachingAuth{staticAuth: staticAuth{
+		"admin":  {ID: 1, Activated: true, Permissions: []string{"auth:admin"}},
+		"reader": {ID: 2, Activated: true, Permissions: []string{"movies:read"}},
+	}}
+	e := newTestServer(t, auth)
+
+	rec := serve(t, e, testRequest{method: http.MethodDelete, target: "/v1/auth/cache/token"})
+	assertStatus(t, rec, http.StatusUnauthorized)
+
+	rec = serve(t, e, testRequest{method: http.MethodDelete, target: "/v1/auth/cache/token", token: "reader"})
+	assertStatus(t, rec, http.StatusOK)
+	if len(auth.tokens) != 1 || auth.tokens[0] != "reader" {
+		t.Fatalf("invalidated tokens = %v, want [reader]", auth.tokens)
+	}
+
+	rec = serve(t, e, testRequest{method: http.MethodDelete, target: "/v1/auth/cache/users/9", token: "reader"})
+	assertStatus(t, rec, http.StatusForbidden)
+	rec = serve(t, e, testRequest{method: http.MethodDelete, target: "/v1/auth/cache", token: "reader"})
+	assertStatus(t, rec, http.StatusForbidden)
+
+	rec = serve(t, e, testRequest{method: http.MethodDelete, target: "/v1/auth/cache/users/9", token: "admin"})
+	assertStatus(t, rec, http.StatusOK)
+	if got := decode[map[string]int](t, rec)["invalidated"]; got != 2 || len(auth.users) != 1 || auth.users[0] != 9 {
+		t.Fatalf("invalidated = %d, users = %v", got, auth.users)
+	}
+
+	rec = serve(t, e, testRequest{method: http.MethodDelete, target: "/v1/auth/cache", token: "admin"})
+	assertStatus(t, rec, http.StatusOK)
+	if auth.all != 1 {
+		t.Fatalf("InvalidateAll called %d times, want 1", auth.all)
+	}
+}
+
+func TestTokenCacheRoutesNeedCachingAuthenticator(t *testing.T) {
+	e := newTestServer(t, staticAuth{
+		"admin": {ID: 1, Activated: true, Permissions: []string{"auth:admin"}},
+	})
+
+	rec := serve(t, e, testRequest{method: http.MethodDelete, target: "/v1/auth/cache", token: "admin"})
+	assertStatus(t, rec, http.StatusNotFound)
+}
@@ -0,0 +1,193 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/AndreyChufelin/movies-api/pkg/validator"
+	"github.com/labstack/echo/v4"
+)
+
+const codeBatchAborted = "batch_aborted"
+
+type batchOperationInput struct {
+	Op      string `json:"op"`
+	ID      int64  `json:"id"`
+	Version int32  `json:"version"`
+	Movie   *struct {
+		Title   string          `json:"title"`
+		Year    int32           `json:"year"`
+		Runtime storage.Runtime `json:"runtime"`
+		Genres  []string        `json:"genres"`
+	} `json:"movie"`
+}
+
+type batchItemResult struct {
+	Index  int             `json:"index"`
+	Status int             `json:"status"`
+	Movie  *storage.Movie  `json:"movie,omitempty"`
+	Error  *batchItemError `json:"error,omitempty"`
+}
+
+type batchItemError struct {
+	Code   string         `json:"code"`
+	Detail string         `json:"detail"`
+	Errors []problemField `json:"errors,omitempty"`
+}
+
+// batchMoviesHandler applies a list of create, update and delete operations.
+// Updates replace the whole movie and must carry the version being replaced.
+// With atomic set, nothing is written unless every operation succeeds.
+func (s *Server) batchMoviesHandler(c echo.Context) error {
+	log := s.log.With("handler", "batch movies")
+	var input struct {
+		Atomic     bool                  `json:"atomic"`
+		Operations []batchOperationInput `json:"operations" validate:"required,min=1,max=500"`
+	}
+
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+	if err = c.Validate(input); err != nil {
+		log.Warn("failed to validate batch", "error", err)
+		return err
+	}
+
+	results := make([]batchItemResult, len(input.Operations))
+	ops := make([]storage.BatchOperation, 0, len(input.Operations))
+	indexes := make([]int, 0, len(input.Operations))
+	invalid := false
+	for i, item := range input.Operations {
+		results[i].Index = i
+		op, err := batchOperation(c, item)
+		if err != nil {
+			results[i].Status = err.Status
+			results[i].Error = newBatchItemError(err, fmt.Sprintf("/operations/%d", i))
+			invalid = true
+			continue
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+
+	if invalid && input.Atomic {
+		log.Warn("atomic batch has invalid operations")
+		for _, i := range indexes {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = newBatchItemError(batchError(storage.ErrBatchAborted), "")
+		}
+		return c.JSON(http.StatusOK, envelope{"results": results})
+	}
+
+	stored, err := s.storage.BatchMovies(c.Request().Context(), ops, input.Atomic)
+	if err != nil {
+		log.Error("failed to run batch", "error", err)
+		return err
+	}
+
+	for j, result := range stored {
+		i := indexes[j]
+		if result.Err != nil {
+			apiErr := batchError(result.Err)
+			results[i].Status = apiErr.Status
+			results[i].Error = newBatchItemError(apiErr, "")
+			continue
+		}
+
+		results[i].Movie = result.Movie
+		switch ops[j].Op {
+		case storage.BatchCreate:
+			results[i].Status = http.StatusCreated
+		case storage.BatchUpdate:
+			results[i].Status = http.StatusOK
+		case storage.BatchDelete:
+			results[i].Status = http.StatusNoContent
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"results": results})
+}
+
+func batchOperation(c echo.Context, item batchOperationInput) (storage.BatchOperation, *apiError) {
+	op := storage.BatchOperation{Op: item.Op, ID: item.ID, Version: item.Version}
+
+	switch item.Op {
+	case storage.BatchCreate, storage.BatchUpdate:
+	case storage.BatchDelete:
+		if item.ID < 1 {
+			return op, batchFieldError("/id", "id must be a positive number")
+		}
+		return op, nil
+	default:
+		return op, batchFieldError("/op", "op must be one of create, update or delete")
+	}
+
+	if item.Op == storage.BatchUpdate && (item.ID < 1 || item.Version < 1) {
+		return op, batchFieldError("/id", "update requires id and version")
+	}
+	if item.Movie == nil {
+		return op, batchFieldError("/movie", "movie is required")
+	}
+
+	op.Movie = &storage.Movie{
+		ID:      item.ID,
+		Title:   item.Movie.Title,
+		Year:    item.Movie.Year,
+		Runtime: item.Movie.Runtime,
+		Genres:  item.Movie.Genres,
+		Version: item.Version,
+	}
+	if err := c.Validate(op.Movie); err != nil {
+		apiErr := toAPIError(err)
+		for i := range apiErr.Errors {
+			apiErr.Errors[i].Pointer = "/movie" + apiErr.Errors[i].Pointer
+		}
+		return op, apiErr
+	}
+
+	return op, nil
+}
+
+func batchFieldError(pointer, message string) *apiError {
+	e := newAPIError(http.StatusUnprocessableEntity, codeValidationFailed, "one or more fields are invalid")
+	e.Errors = append(e.Errors, validator.ValidationError{
+		Field:   strings.TrimPrefix(pointer, "/"),
+		Message: message,
+		Pointer: pointer,
+	})
+	return e
+}
+
+func batchError(err error) *apiError {
+	switch {
+	case errors.Is(err, storage.ErrEditConflict):
+		return newAPIError(http.StatusConflict, codeEditConflict, "unable to apply the operation due to an edit conflict")
+	case errors.Is(err, storage.ErrRecordNotFound):
+		return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+	case errors.Is(err, storage.ErrBatchAborted):
+		return newAPIError(
+			http.StatusFailedDependency,
+			codeBatchAborted,
+			"not applied because another operation in the batch failed",
+		)
+	default:
+		return internalError()
+	}
+}
+
+func newBatchItemError(apiErr *apiError, prefix string) *batchItemError {
+	itemErr := &batchItemError{
+		Code:   apiErr.Code,
+		Detail: apiErr.Detail,
+	}
+	for _, p := range newProblem(apiErr, "").Errors {
+		p.Pointer = prefix + p.Pointer
+		itemErr.Errors = append(itemErr.Errors, p)
+	}
+	return itemErr
+}
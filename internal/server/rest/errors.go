@@ -0,0 +1,209 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AndreyChufelin/movies-api/pkg/validator"
+	"github.com/labstack/echo/v4"
+)
+
+// Error codes are part of the API contract: clients match on them, so
+// existing values must never change meaning.
+const (
+	codeBadRequest             = "bad_request"
+	codeInvalidParameter       = "invalid_parameter"
+	codeValidationFailed       = "validation_failed"
+	codeInvalidToken           = "invalid_token"
+	codeAuthenticationRequired = "authentication_required"
+	codeAccountNotActivated    = "account_not_activated"
+	codePermissionDenied       = "permission_denied"
+	codeNotFound               = "not_found"
+	codeMovieNotFound          = "movie_not_found"
+	codeRevisionNotFound       = "revision_not_found"
+	codePersonNotFound         = "person_not_found"
+	codeCreditNotFound         = "credit_not_found"
+	codeDuplicateCredit        = "duplicate_credit"
+	codeRatingNotFound         = "rating_not_found"
+	codeReviewNotFound         = "review_not_found"
+	codeDuplicateReview        = "duplicate_review"
+	codeListNotFound           = "list_not_found"
+	codeListItemNotFound       = "list_item_not_found"
+	codeDuplicateList          = "duplicate_list"
+	codeDuplicateListItem      = "duplicate_list_item"
+	codeMethodNotAllowed       = "method_not_allowed"
+	codeEditConflict           = "edit_conflict"
+	codePreconditionFailed     = "precondition_failed"
+	codeIdempotencyKeyInUse    = "idempotency_key_in_use"
+	codeIdempotencyKeyReused   = "idempotency_key_reused"
+	codeRequestTooLarge        = "request_too_large"
+	codeRateLimitExceeded      = "rate_limit_exceeded"
+	codeRequestCanceled        = "request_canceled"
+	codeAuthUnavailable        = "auth_unavailable"
+	codeTimeout                = "timeout"
+	codeInternalError          = "internal_error"
+)
+
+// statusClientClosedRequest is the non-standard status used when the client
+// goes away before the response is ready.
+const statusClientClosedRequest = 499
+
+const problemContentType = "application/problem+json"
+
+// apiError is an error response. It renders either as an RFC 7807 problem or,
+// for clients on the legacy format, as {"error": legacy}.
+type apiError struct {
+	Status int
+	Code   string
+	Detail string
+	Errors []validator.ValidationError
+	legacy interface{}
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Detail)
+}
+
+func newAPIError(status int, code, detail string) *apiError {
+	return &apiError{
+		Status: status,
+		Code:   code,
+		Detail: detail,
+		legacy: detail,
+	}
+}
+
+func newFieldErrors(status int, code string, errs []validator.ValidationError) *apiError {
+	return &apiError{
+		Status: status,
+		Code:   code,
+		Detail: "one or more fields are invalid",
+		Errors: errs,
+		legacy: errs,
+	}
+}
+
+func newFieldError(status int, code string, err validator.ValidationError) *apiError {
+	e := newFieldErrors(status, code, []validator.ValidationError{err})
+	e.legacy = err
+	return e
+}
+
+func internalError() *apiError {
+	return newAPIError(http.StatusInternalServerError, codeInternalError, "internal server error")
+}
+
+type problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Code     string         `json:"code"`
+	Errors   []problemField `json:"errors,omitempty"`
+}
+
+type problemField struct {
+	Pointer string `json:"pointer"`
+	Detail  string `json:"detail"`
+}
+
+func (s *Server) customHTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	apiErr := toAPIError(err)
+
+	var respErr error
+	if s.legacyErrors {
+		respErr = c.JSON(apiErr.Status, envelope{
+			"error": apiErr.legacy,
+		})
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, problemContentType)
+		respErr = c.JSON(apiErr.Status, newProblem(apiErr, c.Request().URL.Path))
+	}
+	if respErr != nil {
+		c.Logger().Error(respErr)
+	}
+}
+
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		apiErr = newAPIError(he.Code, httpErrorCode(he.Code), fmt.Sprint(he.Message))
+		apiErr.legacy = he.Message
+		return apiErr
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return newAPIError(http.StatusGatewayTimeout, codeTimeout, "the request timed out")
+	case errors.Is(err, context.Canceled):
+		return newAPIError(statusClientClosedRequest, codeRequestCanceled, "request canceled")
+	default:
+		return internalError()
+	}
+}
+
+// httpErrorCode names the errors echo and its middleware raise on their own.
+func httpErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeAuthenticationRequired
+	case http.StatusForbidden:
+		return codePermissionDenied
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusMethodNotAllowed:
+		return codeMethodNotAllowed
+	case http.StatusRequestEntityTooLarge:
+		return codeRequestTooLarge
+	case http.StatusTooManyRequests:
+		return codeRateLimitExceeded
+	default:
+		if status >= http.StatusInternalServerError {
+			return codeInternalError
+		}
+		return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	}
+}
+
+func newProblem(apiErr *apiError, instance string) problem {
+	title := http.StatusText(apiErr.Status)
+	if apiErr.Status == statusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+
+	p := problem{
+		Type:     "about:blank",
+		Title:    title,
+		Status:   apiErr.Status,
+		Detail:   apiErr.Detail,
+		Instance: instance,
+		Code:     apiErr.Code,
+	}
+	for _, fieldErr := range apiErr.Errors {
+		pointer := fieldErr.Pointer
+		if pointer == "" {
+			pointer = "/" + strings.ReplaceAll(fieldErr.Field, ".", "/")
+		}
+		p.Errors = append(p.Errors, problemField{
+			Pointer: pointer,
+			Detail:  fieldErr.Message,
+		})
+	}
+
+	return p
+}
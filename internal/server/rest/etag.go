@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+// movieETag follows the version only. The rating summary is left out on
+// purpose: it changes whenever anyone rates the movie, and an editor's
+// If-Match must not fail because of that.
+func movieETag(movie *storage.Movie) string {
+	return fmt.Sprintf(`"%d-%d"`, movie.ID, movie.Version)
+}
+
+func personETag(person *storage.Person) string {
+	return fmt.Sprintf(`"%d-%d"`, person.ID, person.Version)
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag.
+// If-None-Match uses the weak comparison, so W/ prefixed tags match too.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func preconditionFailedError() error {
+	return newAPIError(
+		http.StatusPreconditionFailed,
+		codePreconditionFailed,
+		"the resource has been modified, please refetch it",
+	)
+}
@@ -0,0 +1,37 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestMovieETagIgnoresRatings(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	target := fmt.Sprintf("/v1/movies/%d", movie.ID)
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: target, token: "reader"})
+	etag := rec.Header().Get("ETag")
+	if want := fmt.Sprintf(`"%d-%d"`, movie.ID, movie.Version); etag != want {
+		t.Fatalf("ETag = %s, want %s", etag, want)
+	}
+
+	rec = serve(t, e, testRequest{method: http.MethodPut, target: target + "/rating", token: "admin", body: `{"rating":8}`})
+	assertStatus(t, rec, http.StatusOK)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: target, token: "reader"})
+	assertStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("ETag"); got != etag {
+		t.Fatalf("ETag after rating = %s, want %s", got, etag)
+	}
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodPatch,
+		target:  target,
+		token:   "admin",
+		body:    `{"title":"Moonlight (2016)"}`,
+		headers: map[string]string{"If-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusOK)
+}
@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+const exportFlushEvery = 100
+
+// csvGenresSeparator joins genres in a single CSV column.
+const csvGenresSeparator = "|"
+
+var csvExportHeader = []string{"id", "title", "year", "runtime", "genres", "version"}
+
+// exportMoviesHandler streams the whole matching catalog in id order. The
+// status line goes out with the first row, so failures before that still get
+// a regular error response.
+func (s *Server) exportMoviesHandler(c echo.Context) error {
+	log := s.log.With("handler", "export movies")
+	var input struct {
+		Title  string
+		Genres []string
+		Format string `validate:"oneof=ndjson csv"`
+		storage.Filters
+	}
+	input.Format = "ndjson"
+	input.GenresMatch = "all"
+	var genresParam string
+
+	errs := bindMovieFilters(echo.QueryParamsBinder(c), &input.Title, &genresParam, &input.Filters).
+		String("format", &input.Format).
+		BindErrors()
+	if errs != nil {
+		log.Warn("failed to bind filters", "error", errs)
+		return binderErrors(errs)
+	}
+	input.Genres, input.ExcludedGenres = parseGenres(genresParam)
+
+	// Export has no pages; these only satisfy the shared Filters validation.
+	input.Page, input.PageSize = 1, 1
+	input.Sort, input.SortSafelist = "id", []string{"id"}
+
+	if err := c.Validate(input); err != nil {
+		log.Warn("failed to validate filters", "error", err)
+		return err
+	}
+
+	resp := c.Response()
+	rc := http.NewResponseController(resp)
+	var write func(*storage.Movie) error
+	var flush func() error
+	writeHeader := func() error { return nil }
+
+	switch input.Format {
+	case "csv":
+		w := csv.NewWriter(resp)
+		writeHeader = func() error {
+			return w.Write(csvExportHeader)
+		}
+		write = func(movie *storage.Movie) error {
+			return w.Write([]string{
+				strconv.FormatInt(movie.ID, 10),
+				movie.Title,
+				strconv.FormatInt(int64(movie.Year), 10),
+				movie.Runtime.String(),
+				strings.Join(movie.Genres, csvGenresSeparator),
+				strconv.FormatInt(int64(movie.Version), 10),
+			})
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+		resp.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	default:
+		enc := json.NewEncoder(resp)
+		write = func(movie *storage.Movie) error {
+			return enc.Encode(movie)
+		}
+		flush = func() error { return nil }
+		resp.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	}
+	resp.Header().Set(echo.HeaderContentDisposition, `attachment; filename="movies.`+input.Format+`"`)
+
+	start := func() error {
+		resp.WriteHeader(http.StatusOK)
+		return writeHeader()
+	}
+
+	rows := 0
+	err := s.storage.ExportMovies(c.Request().Context(), input.Title, input.Genres, input.Filters,
+		func(movie *storage.Movie) error {
+			if rows == 0 {
+				if err := start(); err != nil {
+					return err
+				}
+			}
+			if err := write(movie); err != nil {
+				return err
+			}
+			rows++
+			if rows%exportFlushEvery == 0 {
+				return s.flushExport(rc, flush)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		log.Error("failed to export movies", "error", err, "rows", rows)
+		return err
+	}
+
+	if rows == 0 {
+		if err := start(); err != nil {
+			return err
+		}
+	}
+	return s.flushExport(rc, flush)
+}
+
+// flushExport pushes buffered rows to the client and moves the write
+// deadline forward, since an export can run longer than the server's
+// write timeout.
+func (s *Server) flushExport(rc *http.ResponseController, flush func() error) error {
+	if err := flush(); err != nil {
+		return err
+	}
+	if s.writeTimout > 0 {
+		if err := rc.SetWriteDeadline(time.Now().Add(s.writeTimout)); err != nil {
+			return err
+		}
+	}
+	return rc.Flush()
+}
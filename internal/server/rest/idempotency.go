@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+	// idempotencyWriteTimeout bounds the bookkeeping done after the handler,
+	// which must not be cut short by a client that already went away.
+	idempotencyWriteTimeout = 3 * time.Second
+)
+
+var replayedHeaders = []string{echo.HeaderContentType, echo.HeaderLocation, "ETag"}
+
+// idempotent replays the stored response when a request is retried with the
+// same Idempotency-Key, so a client can safely retry after a timeout.
+func (s *Server) idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			return next(c)
+		}
+		log := s.log.With("idempotency_key", key)
+		if len(key) > maxIdempotencyKeyLen {
+			return newAPIError(http.StatusBadRequest, codeBadRequest, "idempotency key is too long")
+		}
+
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return newAPIError(http.StatusBadRequest, codeBadRequest, "bad request")
+		}
+		c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+		cc := AuthContext{c}
+		record := &storage.IdempotencyRecord{
+			UserID:      cc.GetUser().ID,
+			Key:         key,
+			Fingerprint: requestFingerprint(c.Request(), body),
+			ExpiresAt:   time.Now().Add(s.idempotencyTTL),
+		}
+
+		ctx := c.Request().Context()
+		err = s.storage.CreateIdempotencyKey(ctx, record)
+		if errors.Is(err, storage.ErrDuplicateIdempotencyKey) {
+			return s.replay(c, record)
+		}
+		if err != nil {
+			log.Error("failed to create idempotency key", "error", err)
+			return err
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = recorder
+
+		err = next(c)
+
+		writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyWriteTimeout)
+		defer cancel()
+
+		if err != nil || c.Response().Status >= http.StatusInternalServerError {
+			if delErr := s.storage.DeleteIdempotencyKey(writeCtx, record.UserID, record.Key); delErr != nil {
+				log.Error("failed to release idempotency key", "error", delErr)
+			}
+			return err
+		}
+
+		record.Status = c.Response().Status
+		record.Header = http.Header{}
+		for _, name := range replayedHeaders {
+			if value := c.Response().Header().Get(name); value != "" {
+				record.Header.Set(name, value)
+			}
+		}
+		record.Body = recorder.body.Bytes()
+		if err := s.storage.CompleteIdempotencyKey(writeCtx, record); err != nil {
+			log.Error("failed to store idempotent response", "error", err)
+		}
+
+		return nil
+	}
+}
+
+func (s *Server) replay(c echo.Context, record *storage.IdempotencyRecord) error {
+	log := s.log.With("idempotency_key", record.Key)
+
+	stored, err := s.storage.GetIdempotencyKey(c.Request().Context(), record.UserID, record.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			// The key expired in between, let the client retry with it.
+			return newAPIError(http.StatusConflict, codeIdempotencyKeyInUse, "idempotency key is in use, please retry")
+		}
+		log.Error("failed to get idempotency key", "error", err)
+		return err
+	}
+
+	if stored.Fingerprint != record.Fingerprint {
+		log.Warn("idempotency key reused with a different request")
+		return newAPIError(
+			http.StatusUnprocessableEntity,
+			codeIdempotencyKeyReused,
+			"idempotency key was already used for a different request",
+		)
+	}
+	if stored.Status == 0 {
+		return newAPIError(
+			http.StatusConflict,
+			codeIdempotencyKeyInUse,
+			"a request with this idempotency key is still in progress",
+		)
+	}
+
+	log.Info("replaying idempotent response")
+	for name, values := range stored.Header {
+		for _, value := range values {
+			c.Response().Header().Add(name, value)
+		}
+	}
+	c.Response().Header().Set("Idempotent-Replayed", "true")
+
+	return c.Blob(stored.Status, stored.Header.Get(echo.HeaderContentType), stored.Body)
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type bodyRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *bodyRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
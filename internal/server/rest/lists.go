@@ -0,0 +1,378 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) listMyListsHandler(c echo.Context) error {
+	log := s.log.With("handler", "list my lists")
+	user := (&AuthContext{c}).GetUser()
+
+	lists, err := s.storage.GetUserLists(c.Request().Context(), user.ID, false)
+	if err != nil {
+		log.Error("failed to get user lists", "error", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"lists": lists,
+	})
+}
+
+func (s *Server) createListHandler(c echo.Context) error {
+	log := s.log.With("handler", "create list")
+	var input struct {
+		Kind   string `json:"kind"`
+		Name   string `json:"name"`
+		Public bool   `json:"public"`
+	}
+	input.Kind = storage.ListCustom
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+
+	user := (&AuthContext{c}).GetUser()
+	list := &storage.List{
+		UserID: user.ID,
+		Kind:   input.Kind,
+		Name:   input.Name,
+		Public: input.Public,
+	}
+	if list.Name == "" && list.Kind != storage.ListCustom {
+		list.Name = list.Kind
+	}
+	if err = c.Validate(list); err != nil {
+		log.Warn("failed to validate list", "error", err)
+		return err
+	}
+
+	err = s.storage.CreateList(c.Request().Context(), list)
+	if err != nil {
+		log.Error("failed to create list", "error", err)
+		if errors.Is(err, storage.ErrDuplicateList) {
+			return newAPIError(http.StatusConflict, codeDuplicateList, fmt.Sprintf("you already have a %s list", list.Kind))
+		}
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/me/lists/%d", list.ID))
+	return c.JSON(http.StatusOK, envelope{
+		"list": list,
+	})
+}
+
+func (s *Server) getMyListHandler(c echo.Context) error {
+	log := s.log.With("handler", "get my list")
+	list, err := s.bindOwnList(c)
+	if err != nil {
+		log.Warn("failed to get list", "error", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"list": list,
+	})
+}
+
+func (s *Server) updateListHandler(c echo.Context) error {
+	log := s.log.With("handler", "update list")
+	var input struct {
+		Name   *string `json:"name"`
+		Public *bool   `json:"public"`
+	}
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+
+	list, err := s.bindOwnList(c)
+	if err != nil {
+		log.Warn("failed to get list", "error", err)
+		return err
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Public != nil {
+		list.Public = *input.Public
+	}
+	if err = c.Validate(list); err != nil {
+		log.Warn("failed to validate list", "error", err)
+		return err
+	}
+
+	err = s.storage.UpdateList(c.Request().Context(), list)
+	if err != nil {
+		log.Error("failed to update list", "error", err)
+		if errors.Is(err, storage.ErrEditConflict) {
+			return newAPIError(
+				http.StatusConflict,
+				codeEditConflict,
+				"unable to update the record due to an edit conflict, please try again",
+			)
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"list": list,
+	})
+}
+
+func (s *Server) deleteListHandler(c echo.Context) error {
+	log := s.log.With("handler", "delete list")
+	list, err := s.bindOwnList(c)
+	if err != nil {
+		log.Warn("failed to get list", "error", err)
+		return err
+	}
+
+	err = s.storage.DeleteList(c.Request().Context(), list.ID)
+	if err != nil {
+		log.Error("failed to delete list", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeListNotFound, "list not found")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "list successfully deleted",
+	})
+}
+
+func (s *Server) listMyListItemsHandler(c echo.Context) error {
+	log := s.log.With("handler", "list my list items")
+	list, err := s.bindOwnList(c)
+	if err != nil {
+		log.Warn("failed to get list", "error", err)
+		return err
+	}
+
+	return s.listItems(c, log, list)
+}
+
+func (s *Server) addListItemHandler(c echo.Context) error {
+	log := s.log.With("handler", "add list item")
+	var input struct {
+		MovieID  int64 `json:"movie_id" validate:"required,gt=0"`
+		Position int32 `json:"position" validate:"gte=0"`
+	}
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+	if err = c.Validate(input); err != nil {
+		log.Warn("failed to validate list item", "error", err)
+		return err
+	}
+
+	list, err := s.bindOwnList(c)
+	if err != nil {
+		log.Warn("failed to get list", "error", err)
+		return err
+	}
+
+	item, err := s.storage.AddListItem(c.Request().Context(), list.ID, input.MovieID, input.Position)
+	if err != nil {
+		log.Error("failed to add list item", "error", err)
+		switch {
+		case errors.Is(err, storage.ErrRecordNotFound):
+			return newAPIError(http.StatusUnprocessableEntity, codeMovieNotFound, "movie not found")
+		case errors.Is(err, storage.ErrDuplicateListItem):
+			return newAPIError(http.StatusConflict, codeDuplicateListItem, "the movie is already in the list")
+		default:
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"item": item,
+	})
+}
+
+func (s *Server) moveListItemHandler(c echo.Context) error {
+	log := s.log.With("handler", "move list item")
+	var input struct {
+		MovieID  int64 `param:"movie_id"`
+		Position int32 `json:"position" validate:"required,gt=0"`
+	}
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+	if err = c.Validate(input); err != nil {
+		log.Warn("failed to validate position", "error", err)
+		return err
+	}
+
+	list, err := s.bindOwnList(c)
+	if err != nil {
+		log.Warn("failed to get list", "error", err)
+		return err
+	}
+
+	err = s.storage.MoveListItem(c.Request().Context(), list.ID, input.MovieID, input.Position)
+	if err != nil {
+		log.Error("failed to move list item", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeListItemNotFound, "the movie is not in the list")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "list item successfully moved",
+	})
+}
+
+func (s *Server) removeListItemHandler(c echo.Context) error {
+	log := s.log.With("handler", "remove list item")
+	var movieID int64
+	err := echo.PathParamsBinder(c).
+		Int64("movie_id", &movieID).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	list, err := s.bindOwnList(c)
+	if err != nil {
+		log.Warn("failed to get list", "error", err)
+		return err
+	}
+
+	err = s.storage.RemoveListItem(c.Request().Context(), list.ID, movieID)
+	if err != nil {
+		log.Error("failed to remove list item", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeListItemNotFound, "the movie is not in the list")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "list item successfully removed",
+	})
+}
+
+func (s *Server) listUserListsHandler(c echo.Context) error {
+	log := s.log.With("handler", "list user lists")
+	var userID int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &userID).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	lists, err := s.storage.GetUserLists(c.Request().Context(), userID, true)
+	if err != nil {
+		log.Error("failed to get user lists", "error", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"lists": lists,
+	})
+}
+
+func (s *Server) listUserListItemsHandler(c echo.Context) error {
+	log := s.log.With("handler", "list user list items")
+	var userID, listID int64
+	errs := echo.PathParamsBinder(c).
+		FailFast(false).
+		Int64("id", &userID).
+		Int64("list_id", &listID).
+		BindErrors()
+	if errs != nil {
+		log.Warn("failed to bind parameters", "error", errs)
+		return binderErrors(errs)
+	}
+
+	list, err := s.storage.GetList(c.Request().Context(), listID)
+	if err != nil && !errors.Is(err, storage.ErrRecordNotFound) {
+		log.Error("failed to get list", "error", err)
+		return err
+	}
+	if err != nil || list.UserID != userID || !list.Public {
+		return newAPIError(http.StatusNotFound, codeListNotFound, "list not found")
+	}
+
+	return s.listItems(c, log, list)
+}
+
+func (s *Server) listItems(c echo.Context, log *slog.Logger, list *storage.List) error {
+	var input struct {
+		Page     int `validate:"gt=0,max=10000000"`
+		PageSize int `validate:"gt=0,max=100"`
+	}
+	input.Page = 1
+	input.PageSize = 20
+
+	errs := echo.QueryParamsBinder(c).
+		FailFast(false).
+		Int("page", &input.Page).
+		Int("page_size", &input.PageSize).
+		BindErrors()
+	if errs != nil {
+		log.Warn("failed to bind parameters", "error", errs)
+		return binderErrors(errs)
+	}
+	if err := c.Validate(input); err != nil {
+		log.Warn("failed to validate parameters", "error", err)
+		return err
+	}
+
+	items, metadata, err := s.storage.GetListItems(c.Request().Context(), list.ID, storage.Filters{
+		Page:     input.Page,
+		PageSize: input.PageSize,
+	})
+	if err != nil {
+		log.Error("failed to get list items", "error", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"list":     list,
+		"items":    items,
+		"metadata": metadata,
+	})
+}
+
+// bindOwnList loads the list named by the id path parameter. Lists of other
+// users are reported as missing rather than forbidden.
+func (s *Server) bindOwnList(c echo.Context) (*storage.List, error) {
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		return nil, binderError(err)
+	}
+
+	list, err := s.storage.GetList(c.Request().Context(), id)
+	if err != nil && !errors.Is(err, storage.ErrRecordNotFound) {
+		return nil, err
+	}
+	user := (&AuthContext{c}).GetUser()
+	if err != nil || list.UserID != user.ID {
+		return nil, newAPIError(http.StatusNotFound, codeListNotFound, "list not found")
+	}
+
+	return list, nil
+}
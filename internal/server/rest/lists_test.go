@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type listResponse struct {
+	List storage.List `json:"list"`
+}
+
+type listItemsResponse struct {
+	List  storage.List       `json:"list"`
+	Items []storage.ListItem `json:"items"`
+}
+
+func createTestList(t *testing.T, e *echo.Echo, token, body string) storage.List {
+	t.Helper()
+
+	rec := serve(t, e, testRequest{method: http.MethodPost, target: "/v1/me/lists", token: token, body: body})
+	assertStatus(t, rec, http.StatusOK)
+	return decode[listResponse](t, rec).List
+}
+
+func addTestListItem(t *testing.T, e *echo.Echo, token string, listID, movieID int64) {
+	t.Helper()
+
+	rec := serve(t, e, testRequest{
+		method: http.MethodPost,
+		target: fmt.Sprintf("/v1/me/lists/%d/items", listID),
+		token:  token,
+		body:   fmt.Sprintf(`{"movie_id":%d}`, movieID),
+	})
+	assertStatus(t, rec, http.StatusOK)
+}
+
+func TestOwnListsOfOtherUsers(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	list := createTestList(t, e, "writer", `{"name":"Later","public":true}`)
+	addTestListItem(t, e, "writer", list.ID, movie.ID)
+	target := fmt.Sprintf("/v1/me/lists/%d", list.ID)
+
+	// Even a public list is only managed through /v1/me by its owner, and
+	// everyone else is told it does not exist.
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{name: "get", method: http.MethodGet, target: target},
+		{name: "update", method: http.MethodPatch, target: target, body: `{"name":"Mine now"}`},
+		{name: "delete", method: http.MethodDelete, target: target},
+		{name: "items", method: http.MethodGet, target: target + "/items"},
+		{name: "add item", method: http.MethodPost, target: target + "/items", body: fmt.Sprintf(`{"movie_id":%d}`, movie.ID)},
+		{name: "move item", method: http.MethodPatch, target: fmt.Sprintf("%s/items/%d", target, movie.ID), body: `{"position":1}`},
+		{name: "remove item", method: http.MethodDelete, target: fmt.Sprintf("%s/items/%d", target, movie.ID)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: tt.method, target: tt.target, token: "reader", body: tt.body})
+			assertStatus(t, rec, http.StatusNotFound)
+			assertCode(t, rec, codeListNotFound)
+		})
+	}
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: target + "/items", token: "writer"})
+	assertStatus(t, rec, http.StatusOK)
+	resp := decode[listItemsResponse](t, rec)
+	if resp.List.Name != "Later" || len(resp.Items) != 1 || resp.Items[0].Movie.ID != movie.ID {
+		t.Fatalf("list after other users' requests = %+v", resp)
+	}
+}
+
+func TestUserLists(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	public := createTestList(t, e, "writer", `{"name":"Shared","public":true}`)
+	private := createTestList(t, e, "writer", `{"kind":"watchlist"}`)
+	addTestListItem(t, e, "writer", public.ID, movie.ID)
+	addTestListItem(t, e, "writer", private.ID, movie.ID)
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/users/4/lists"})
+	assertStatus(t, rec, http.StatusOK)
+	var names []string
+	for _, list := range decode[struct {
+		Lists []storage.List `json:"lists"`
+	}](t, rec).Lists {
+		names = append(names, list.Name)
+	}
+	if !slices.Equal(names, []string{"Shared"}) {
+		t.Fatalf("public lists = %v, want only the shared one", names)
+	}
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: fmt.Sprintf("/v1/users/4/lists/%d/items", public.ID)})
+	assertStatus(t, rec, http.StatusOK)
+	resp := decode[listItemsResponse](t, rec)
+	if resp.List.ID != public.ID || len(resp.Items) != 1 || resp.Items[0].Movie.Title != "Moonlight" {
+		t.Fatalf("public list = %+v", resp)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+	}{
+		{name: "private list", target: fmt.Sprintf("/v1/users/4/lists/%d/items", private.ID)},
+		// The owner reads their private lists through /v1/me, not here.
+		{name: "private list as its owner", target: fmt.Sprintf("/v1/users/4/lists/%d/items", private.ID), token: "writer"},
+		{name: "list of another user", target: fmt.Sprintf("/v1/users/2/lists/%d/items", public.ID)},
+		{name: "unknown list", target: "/v1/users/4/lists/999/items"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: http.MethodGet, target: tt.target, token: tt.token})
+			assertStatus(t, rec, http.StatusNotFound)
+			assertCode(t, rec, codeListNotFound)
+		})
+	}
+
+	// Making the list private takes it off the public routes.
+	rec = serve(t, e, testRequest{
+		method: http.MethodPatch,
+		target: fmt.Sprintf("/v1/me/lists/%d", public.ID),
+		token:  "writer",
+		body:   `{"public":false}`,
+	})
+	assertStatus(t, rec, http.StatusOK)
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: fmt.Sprintf("/v1/users/4/lists/%d/items", public.ID)})
+	assertStatus(t, rec, http.StatusNotFound)
+	assertCode(t, rec, codeListNotFound)
+}
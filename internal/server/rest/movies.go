@@ -36,13 +36,14 @@ func (s *Server) createMovieHandler(c echo.Context) error {
 		return err
 	}
 
-	err = s.storage.CreateMovie(movie)
+	err = s.storage.CreateMovie(c.Request().Context(), movie)
 	if err != nil {
 		log.Error("failed to create movie", "error", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+		return err
 	}
 
 	c.Response().Header().Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	c.Response().Header().Set("ETag", movieETag(movie))
 
 	return c.JSON(http.StatusOK, envelope{
 		"movie": movie,
@@ -57,21 +58,26 @@ func (s *Server) getMovieHandler(c echo.Context) error {
 		BindError()
 	if err != nil {
 		log.Warn("failed to bind parameters", "error", err)
-		return err
-		// return binderError(err)
+		return binderError(err)
 	}
 
-	movie, err := s.storage.GetMovie(id)
+	movie, err := s.storage.GetMovie(c.Request().Context(), id)
 	if err != nil {
 		log.Error("failed to get movie", "error", err)
 		switch {
 		case errors.Is(err, storage.ErrRecordNotFound):
-			return echo.NewHTTPError(http.StatusNotFound, "movie not found")
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
 		default:
-			return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+			return err
 		}
 	}
 
+	etag := movieETag(movie)
+	c.Response().Header().Set("ETag", etag)
+	if ifNoneMatch := c.Request().Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
 	return c.JSON(http.StatusOK, envelope{
 		"movie": movie,
 	})
@@ -93,16 +99,23 @@ func (s *Server) updateMovieHandler(c echo.Context) error {
 		return err
 	}
 
-	movie, err := s.storage.GetMovie(input.ID)
+	ifMatch := c.Request().Header.Get("If-Match")
+	movie, err := s.storage.GetMovie(c.Request().Context(), input.ID)
 	if err != nil {
 		log.Error("failed to get movie", "error", err)
 		switch {
+		case errors.Is(err, storage.ErrRecordNotFound) && ifMatch != "":
+			return preconditionFailedError()
 		case errors.Is(err, storage.ErrRecordNotFound):
-			return echo.NewHTTPError(http.StatusNotFound, "movie not found")
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
 		default:
-			return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+			return err
 		}
 	}
+	if ifMatch != "" && !etagMatches(ifMatch, movieETag(movie), false) {
+		log.Warn("movie etag does not match", "if_match", ifMatch)
+		return preconditionFailedError()
+	}
 
 	if input.Title != nil {
 		movie.Title = *input.Title
@@ -122,20 +135,24 @@ func (s *Server) updateMovieHandler(c echo.Context) error {
 		return err
 	}
 
-	err = s.storage.UpdateMovie(movie)
+	err = s.storage.UpdateMovie(c.Request().Context(), movie)
 	if err != nil {
 		log.Error("failed to update movie", "error", err)
 		switch {
+		case errors.Is(err, storage.ErrEditConflict) && ifMatch != "":
+			return preconditionFailedError()
 		case errors.Is(err, storage.ErrEditConflict):
-			return echo.NewHTTPError(
-				http.StatusNotFound,
+			return newAPIError(
+				http.StatusConflict,
+				codeEditConflict,
 				"unable to update the record due to an edit conflict, please try again",
 			)
 		default:
-			return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+			return err
 		}
 	}
 
+	c.Response().Header().Set("ETag", movieETag(movie))
 	return c.JSON(http.StatusOK, envelope{
 		"movie": movie,
 	})
@@ -152,14 +169,34 @@ func (s *Server) deleteMovieHandler(c echo.Context) error {
 		return binderError(err)
 	}
 
-	err = s.storage.DeleteMovie(id)
+	var version int32
+	ifMatch := c.Request().Header.Get("If-Match")
+	if ifMatch != "" {
+		movie, err := s.storage.GetMovie(c.Request().Context(), id)
+		if err != nil {
+			log.Error("failed to get movie", "error", err)
+			if errors.Is(err, storage.ErrRecordNotFound) {
+				return preconditionFailedError()
+			}
+			return err
+		}
+		if !etagMatches(ifMatch, movieETag(movie), false) {
+			log.Warn("movie etag does not match", "if_match", ifMatch)
+			return preconditionFailedError()
+		}
+		version = movie.Version
+	}
+
+	err = s.storage.DeleteMovie(c.Request().Context(), id, version)
 	if err != nil {
 		log.Error("failed to delete movie", "error", err)
 		switch {
 		case errors.Is(err, storage.ErrRecordNotFound):
-			return echo.NewHTTPError(http.StatusNotFound, "movie not found")
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+		case errors.Is(err, storage.ErrEditConflict):
+			return preconditionFailedError()
 		default:
-			return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+			return err
 		}
 	}
 
@@ -173,48 +210,165 @@ func (s *Server) listMoviesHandler(c echo.Context) error {
 	var input struct {
 		Title  string
 		Genres []string
+		Facets []string `validate:"unique,dive,oneof=genres year runtime"`
 		storage.Filters
 	}
-	var genresParam string
+	input.Page = 1
+	input.PageSize = 20
+	input.IncludeTotal = true
+	input.GenresMatch = "all"
+	var genresParam, cursorParam, facetsParam string
 
-	errs := echo.QueryParamsBinder(c).
-		FailFast(false).
-		String("title", &input.Title).
-		String("genres", &genresParam).
+	errs := bindMovieFilters(echo.QueryParamsBinder(c), &input.Title, &genresParam, &input.Filters).
 		Int("page", &input.Page).
 		Int("page_size", &input.PageSize).
 		String("sort", &input.Sort).
+		String("cursor", &cursorParam).
+		Bool("include_total", &input.IncludeTotal).
+		Bool("fuzzy", &input.Fuzzy).
+		String("facets", &facetsParam).
 		BindErrors()
 	if errs != nil {
 		log.Warn("failed to bind filters", "error", errs)
 		return binderErrors(errs)
 	}
 
-	input.Genres = strings.Split(genresParam, ",")
+	input.Genres, input.ExcludedGenres = parseGenres(genresParam)
+	if facetsParam != "" {
+		input.Facets = strings.Split(facetsParam, ",")
+	}
 
-	input.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	if cursorParam != "" {
+		cursor, err := storage.DecodeCursor(cursorParam)
+		if err != nil || (input.Sort != "" && input.Sort != cursor.Sort) {
+			log.Warn("invalid cursor", "cursor", cursorParam)
+			return invalidCursorError()
+		}
+		input.Sort = cursor.Sort
+		input.Fuzzy = cursor.Fuzzy
+		input.Cursor = cursor
+	}
+	if input.Sort == "" {
+		input.Sort = "id"
+	}
+
+	input.SortSafelist = []string{
+		"id", "title", "year", "runtime", "rating", "-id", "-title", "-year", "-runtime", "-rating", "relevance",
+	}
 
 	if err := c.Validate(input); err != nil {
 		log.Warn("failed to validate filters", "error", err)
 		return err
 	}
 
-	movies, metadata, err := s.storage.GetAllMovies(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := s.storage.GetAllMovies(c.Request().Context(), input.Title, input.Genres, input.Filters)
 	if err != nil {
 		log.Error("failed to get all movies", "error", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return invalidCursorError()
+		}
+		return err
 	}
 
-	return c.JSON(http.StatusOK, envelope{
+	response := envelope{
 		"movies":   movies,
 		"metadata": metadata,
+	}
+
+	if len(input.Facets) > 0 {
+		filters := input.Filters
+		filters.Fuzzy = filters.Fuzzy || metadata.Fuzzy
+		facets, err := s.storage.GetMovieFacets(c.Request().Context(), input.Title, input.Genres, filters, input.Facets)
+		if err != nil {
+			log.Error("failed to get movie facets", "error", err)
+			return err
+		}
+		response["facets"] = facets
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) suggestMoviesHandler(c echo.Context) error {
+	log := s.log.With("handler", "suggest movies")
+	var input struct {
+		Query string `query:"q" validate:"required,max=100"`
+		Limit int    `validate:"gt=0,max=20"`
+	}
+	input.Limit = 10
+
+	errs := echo.QueryParamsBinder(c).
+		FailFast(false).
+		String("q", &input.Query).
+		Int("limit", &input.Limit).
+		BindErrors()
+	if errs != nil {
+		log.Warn("failed to bind parameters", "error", errs)
+		return binderErrors(errs)
+	}
+
+	input.Query = strings.TrimSpace(input.Query)
+	if err := c.Validate(input); err != nil {
+		log.Warn("failed to validate parameters", "error", err)
+		return err
+	}
+
+	suggestions, err := s.storage.SuggestMovies(c.Request().Context(), input.Query, input.Limit)
+	if err != nil {
+		log.Error("failed to suggest movies", "error", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"suggestions": suggestions,
+	})
+}
+
+// bindMovieFilters binds the query parameters shared by every endpoint that
+// searches the catalog.
+func bindMovieFilters(b *echo.ValueBinder, title, genres *string, filters *storage.Filters) *echo.ValueBinder {
+	return b.
+		FailFast(false).
+		String("title", title).
+		String("genres", genres).
+		Int32("year_from", &filters.YearFrom).
+		Int32("year_to", &filters.YearTo).
+		Int32("runtime_min", &filters.RuntimeMin).
+		Int32("runtime_max", &filters.RuntimeMax).
+		String("genres_match", &filters.GenresMatch).
+		Int64("person", &filters.PersonID).
+		Float64("min_rating", &filters.MinRating)
+}
+
+// parseGenres splits the genres parameter into genres a movie must have and
+// genres prefixed with "-" that it must not have.
+func parseGenres(param string) ([]string, []string) {
+	included, excluded := []string{}, []string{}
+	for _, genre := range strings.Split(param, ",") {
+		genre = strings.TrimSpace(genre)
+		switch {
+		case genre == "" || genre == "-":
+			continue
+		case strings.HasPrefix(genre, "-"):
+			excluded = append(excluded, genre[1:])
+		default:
+			included = append(included, genre)
+		}
+	}
+	return included, excluded
+}
+
+func invalidCursorError() error {
+	return newFieldError(http.StatusBadRequest, codeInvalidParameter, validator.ValidationError{
+		Field:   "cursor",
+		Message: "invalid value",
 	})
 }
 
 func binderError(err error) error {
 	var verr *echo.BindingError
 	if ok := errors.As(err, &verr); ok {
-		return echo.NewHTTPError(http.StatusBadRequest, validator.ValidationError{
+		return newFieldError(http.StatusBadRequest, codeInvalidParameter, validator.ValidationError{
 			Field:   verr.Field,
 			Message: "invalid value",
 		})
@@ -236,5 +390,5 @@ func binderErrors(errs []error) error {
 		panic("failed to bind pathparams")
 	}
 
-	return echo.NewHTTPError(http.StatusBadRequest, result)
+	return newFieldErrors(http.StatusBadRequest, codeInvalidParameter, result)
 }
@@ -0,0 +1,204 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+const moonlight = `{"title":"Moonlight","year":2016,"runtime":"111 mins","genres":["drama"]}`
+
+func TestCreateMovie(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+		code   string
+	}{
+		{name: "valid", token: "admin", body: moonlight, status: http.StatusOK},
+		{
+			name:   "missing title",
+			token:  "admin",
+			body:   `{"year":2016,"runtime":"111 mins","genres":["drama"]}`,
+			status: http.StatusUnprocessableEntity,
+			code:   codeValidationFailed,
+		},
+		{
+			name:   "year too early",
+			token:  "admin",
+			body:   `{"title":"Moonlight","year":1700,"runtime":"111 mins","genres":["drama"]}`,
+			status: http.StatusUnprocessableEntity,
+			code:   codeValidationFailed,
+		},
+		{
+			name:   "malformed runtime",
+			token:  "admin",
+			body:   `{"title":"Moonlight","year":2016,"runtime":"111","genres":["drama"]}`,
+			status: http.StatusBadRequest,
+		},
+		{name: "missing permission", token: "reader", body: moonlight, status: http.StatusForbidden, code: codePermissionDenied},
+		{name: "anonymous", body: moonlight, status: http.StatusUnauthorized, code: codeAuthenticationRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestServer(t, testUsers)
+
+			rec := serve(t, e, testRequest{method: http.MethodPost, target: "/v1/movies", token: tt.token, body: tt.body})
+			assertStatus(t, rec, tt.status)
+			if tt.code != "" {
+				assertCode(t, rec, tt.code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			movie := decode[movieResponse](t, rec).Movie
+			if movie.ID == 0 || movie.Version != 1 || movie.Title != "Moonlight" {
+				t.Fatalf("unexpected movie %+v", movie)
+			}
+			if got, want := rec.Header().Get("Location"), fmt.Sprintf("/v1/movies/%d", movie.ID); got != want {
+				t.Fatalf("Location = %q, want %q", got, want)
+			}
+			if rec.Header().Get("ETag") == "" {
+				t.Fatal("ETag is not set")
+			}
+		})
+	}
+}
+
+func TestGetMovie(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	target := fmt.Sprintf("/v1/movies/%d", movie.ID)
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: target, token: "reader"})
+	assertStatus(t, rec, http.StatusOK)
+	if got := decode[movieResponse](t, rec).Movie; got.Title != movie.Title || got.Year != movie.Year {
+		t.Fatalf("got %+v, want %+v", got, movie)
+	}
+	etag := rec.Header().Get("ETag")
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodGet,
+		target:  target,
+		token:   "reader",
+		headers: map[string]string{"If-None-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusNotModified)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: "/v1/movies/9999", token: "reader"})
+	assertStatus(t, rec, http.StatusNotFound)
+	assertCode(t, rec, codeMovieNotFound)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: "/v1/movies/abc", token: "reader"})
+	assertStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestUpdateMovie(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	target := fmt.Sprintf("/v1/movies/%d", movie.ID)
+
+	rec := serve(t, e, testRequest{
+		method:  http.MethodPatch,
+		target:  target,
+		token:   "admin",
+		body:    `{"year":2017}`,
+		headers: map[string]string{"If-Match": `"stale"`},
+	})
+	assertStatus(t, rec, http.StatusPreconditionFailed)
+	assertCode(t, rec, codePreconditionFailed)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: target, token: "reader"})
+	etag := rec.Header().Get("ETag")
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodPatch,
+		target:  target,
+		token:   "admin",
+		body:    `{"year":2017}`,
+		headers: map[string]string{"If-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusOK)
+	updated := decode[movieResponse](t, rec).Movie
+	if updated.Year != 2017 || updated.Title != movie.Title || updated.Version != movie.Version+1 {
+		t.Fatalf("unexpected movie after update %+v", updated)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Fatal("ETag did not change after update")
+	}
+
+	rec = serve(t, e, testRequest{method: http.MethodPatch, target: target, token: "admin", body: `{"genres":[]}`})
+	assertStatus(t, rec, http.StatusUnprocessableEntity)
+}
+
+func TestDeleteMovie(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	target := fmt.Sprintf("/v1/movies/%d", movie.ID)
+
+	rec := serve(t, e, testRequest{method: http.MethodDelete, target: target, token: "admin"})
+	assertStatus(t, rec, http.StatusOK)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: target, token: "reader"})
+	assertStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(t, e, testRequest{method: http.MethodDelete, target: target, token: "admin"})
+	assertStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(t, e, testRequest{method: http.MethodPost, target: target + "/restore", token: "admin"})
+	assertStatus(t, rec, http.StatusOK)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: target, token: "reader"})
+	assertStatus(t, rec, http.StatusOK)
+}
+
+func TestListMovies(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	createTestMovie(t, e, moonlight)
+	createTestMovie(t, e, `{"title":"Arrival","year":2016,"runtime":"116 mins","genres":["drama","sci-fi"]}`)
+	createTestMovie(t, e, `{"title":"Alien","year":1979,"runtime":"117 mins","genres":["horror","sci-fi"]}`)
+
+	type listResponse struct {
+		Movies   []storage.Movie  `json:"movies"`
+		Metadata storage.Metadata `json:"metadata"`
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		titles []string
+		total  int
+	}{
+		{name: "all", query: "", titles: []string{"Moonlight", "Arrival", "Alien"}, total: 3},
+		{name: "genre", query: "?genres=sci-fi", titles: []string{"Arrival", "Alien"}, total: 2},
+		{name: "sort by year", query: "?sort=-year", titles: []string{"Moonlight", "Arrival", "Alien"}, total: 3},
+		{name: "page", query: "?sort=title&page=2&page_size=2", titles: []string{"Moonlight"}, total: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/movies" + tt.query, token: "reader"})
+			assertStatus(t, rec, http.StatusOK)
+
+			resp := decode[listResponse](t, rec)
+			var titles []string
+			for _, m := range resp.Movies {
+				titles = append(titles, m.Title)
+			}
+			if fmt.Sprint(titles) != fmt.Sprint(tt.titles) {
+				t.Fatalf("titles = %v, want %v", titles, tt.titles)
+			}
+			if resp.Metadata.TotalRecords != tt.total {
+				t.Fatalf("total = %d, want %d", resp.Metadata.TotalRecords, tt.total)
+			}
+		})
+	}
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/movies?sort=budget", token: "reader"})
+	assertStatus(t, rec, http.StatusUnprocessableEntity)
+}
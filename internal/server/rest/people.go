@@ -0,0 +1,372 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) createPersonHandler(c echo.Context) error {
+	log := s.log.With("handler", "create person")
+	var input struct {
+		Name string `json:"name"`
+	}
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input parametrs", "error", err)
+		return err
+	}
+
+	person := &storage.Person{
+		Name: input.Name,
+	}
+	if err = c.Validate(person); err != nil {
+		log.Warn("failed to validate person data", "error", err)
+		return err
+	}
+
+	err = s.storage.CreatePerson(c.Request().Context(), person)
+	if err != nil {
+		log.Error("failed to create person", "error", err)
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/people/%d", person.ID))
+	c.Response().Header().Set("ETag", personETag(person))
+
+	return c.JSON(http.StatusOK, envelope{
+		"person": person,
+	})
+}
+
+func (s *Server) getPersonHandler(c echo.Context) error {
+	log := s.log.With("handler", "get person")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	person, err := s.storage.GetPerson(c.Request().Context(), id)
+	if err != nil {
+		log.Error("failed to get person", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codePersonNotFound, "person not found")
+		}
+		return err
+	}
+
+	etag := personETag(person)
+	c.Response().Header().Set("ETag", etag)
+	if ifNoneMatch := c.Request().Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"person": person,
+	})
+}
+
+func (s *Server) listPeopleHandler(c echo.Context) error {
+	log := s.log.With("handler", "list people")
+	var input struct {
+		Name         string
+		Page         int    `validate:"gt=0,max=10000000"`
+		PageSize     int    `validate:"gt=0,max=100"`
+		Sort         string `validate:"safesort"`
+		SortSafelist []string
+	}
+	input.Page = 1
+	input.PageSize = 20
+	input.Sort = "id"
+
+	errs := echo.QueryParamsBinder(c).
+		FailFast(false).
+		String("name", &input.Name).
+		Int("page", &input.Page).
+		Int("page_size", &input.PageSize).
+		String("sort", &input.Sort).
+		BindErrors()
+	if errs != nil {
+		log.Warn("failed to bind filters", "error", errs)
+		return binderErrors(errs)
+	}
+
+	input.SortSafelist = []string{"id", "name", "-id", "-name"}
+
+	if err := c.Validate(input); err != nil {
+		log.Warn("failed to validate filters", "error", err)
+		return err
+	}
+
+	people, metadata, err := s.storage.GetAllPeople(c.Request().Context(), input.Name, storage.Filters{
+		Page:         input.Page,
+		PageSize:     input.PageSize,
+		Sort:         input.Sort,
+		SortSafelist: input.SortSafelist,
+	})
+	if err != nil {
+		log.Error("failed to get all people", "error", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"people":   people,
+		"metadata": metadata,
+	})
+}
+
+func (s *Server) updatePersonHandler(c echo.Context) error {
+	log := s.log.With("handler", "update person")
+	var input struct {
+		ID   int64   `param:"id"`
+		Name *string `json:"name"`
+	}
+
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+
+	ifMatch := c.Request().Header.Get("If-Match")
+	person, err := s.storage.GetPerson(c.Request().Context(), input.ID)
+	if err != nil {
+		log.Error("failed to get person", "error", err)
+		switch {
+		case errors.Is(err, storage.ErrRecordNotFound) && ifMatch != "":
+			return preconditionFailedError()
+		case errors.Is(err, storage.ErrRecordNotFound):
+			return newAPIError(http.StatusNotFound, codePersonNotFound, "person not found")
+		default:
+			return err
+		}
+	}
+	if ifMatch != "" && !etagMatches(ifMatch, personETag(person), false) {
+		log.Warn("person etag does not match", "if_match", ifMatch)
+		return preconditionFailedError()
+	}
+
+	if input.Name != nil {
+		person.Name = *input.Name
+	}
+
+	if err = c.Validate(person); err != nil {
+		log.Warn("failed to validate person", "error", err)
+		return err
+	}
+
+	err = s.storage.UpdatePerson(c.Request().Context(), person)
+	if err != nil {
+		log.Error("failed to update person", "error", err)
+		switch {
+		case errors.Is(err, storage.ErrEditConflict) && ifMatch != "":
+			return preconditionFailedError()
+		case errors.Is(err, storage.ErrEditConflict):
+			return newAPIError(
+				http.StatusConflict,
+				codeEditConflict,
+				"unable to update the record due to an edit conflict, please try again",
+			)
+		default:
+			return err
+		}
+	}
+
+	c.Response().Header().Set("ETag", personETag(person))
+	return c.JSON(http.StatusOK, envelope{
+		"person": person,
+	})
+}
+
+func (s *Server) deletePersonHandler(c echo.Context) error {
+	log := s.log.With("handler", "delete person")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parametrs", "error", err)
+		return binderError(err)
+	}
+
+	var version int32
+	ifMatch := c.Request().Header.Get("If-Match")
+	if ifMatch != "" {
+		person, err := s.storage.GetPerson(c.Request().Context(), id)
+		if err != nil {
+			log.Error("failed to get person", "error", err)
+			if errors.Is(err, storage.ErrRecordNotFound) {
+				return preconditionFailedError()
+			}
+			return err
+		}
+		if !etagMatches(ifMatch, personETag(person), false) {
+			log.Warn("person etag does not match", "if_match", ifMatch)
+			return preconditionFailedError()
+		}
+		version = person.Version
+	}
+
+	err = s.storage.DeletePerson(c.Request().Context(), id, version)
+	if err != nil {
+		log.Error("failed to delete person", "error", err)
+		switch {
+		case errors.Is(err, storage.ErrRecordNotFound):
+			return newAPIError(http.StatusNotFound, codePersonNotFound, "person not found")
+		case errors.Is(err, storage.ErrEditConflict):
+			return preconditionFailedError()
+		default:
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "person successfully deleted",
+	})
+}
+
+func (s *Server) getFilmographyHandler(c echo.Context) error {
+	log := s.log.With("handler", "get filmography")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	credits, err := s.storage.GetFilmography(c.Request().Context(), id)
+	if err != nil {
+		log.Error("failed to get filmography", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codePersonNotFound, "person not found")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"filmography": credits,
+	})
+}
+
+func (s *Server) listMovieCreditsHandler(c echo.Context) error {
+	log := s.log.With("handler", "list movie credits")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	credits, err := s.storage.GetMovieCredits(c.Request().Context(), id)
+	if err != nil {
+		log.Error("failed to get movie credits", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"credits": credits,
+	})
+}
+
+func (s *Server) createMovieCreditHandler(c echo.Context) error {
+	log := s.log.With("handler", "create movie credit")
+	var input struct {
+		MovieID      int64  `param:"id"`
+		PersonID     int64  `json:"person_id"`
+		Role         string `json:"role"`
+		Character    string `json:"character"`
+		BillingOrder int32  `json:"billing_order"`
+	}
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+
+	credit := &storage.Credit{
+		MovieID:      input.MovieID,
+		PersonID:     input.PersonID,
+		Role:         input.Role,
+		Character:    input.Character,
+		BillingOrder: input.BillingOrder,
+	}
+	if err = c.Validate(credit); err != nil {
+		log.Warn("failed to validate credit", "error", err)
+		return err
+	}
+
+	if _, err := s.storage.GetMovie(c.Request().Context(), credit.MovieID); err != nil {
+		log.Error("failed to get movie", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+		}
+		return err
+	}
+	person, err := s.storage.GetPerson(c.Request().Context(), credit.PersonID)
+	if err != nil {
+		log.Error("failed to get person", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusUnprocessableEntity, codePersonNotFound, "person not found")
+		}
+		return err
+	}
+
+	err = s.storage.CreateMovieCredit(c.Request().Context(), credit)
+	if err != nil {
+		log.Error("failed to create movie credit", "error", err)
+		switch {
+		case errors.Is(err, storage.ErrRecordNotFound):
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+		case errors.Is(err, storage.ErrDuplicateCredit):
+			return newAPIError(http.StatusConflict, codeDuplicateCredit, "the person already has this credit")
+		default:
+			return err
+		}
+	}
+	credit.PersonName = person.Name
+
+	return c.JSON(http.StatusOK, envelope{
+		"credit": credit,
+	})
+}
+
+func (s *Server) deleteMovieCreditHandler(c echo.Context) error {
+	log := s.log.With("handler", "delete movie credit")
+	var movieID, creditID int64
+	errs := echo.PathParamsBinder(c).
+		FailFast(false).
+		Int64("id", &movieID).
+		Int64("credit_id", &creditID).
+		BindErrors()
+	if errs != nil {
+		log.Warn("failed to bind parameters", "error", errs)
+		return binderErrors(errs)
+	}
+
+	err := s.storage.DeleteMovieCredit(c.Request().Context(), movieID, creditID)
+	if err != nil {
+		log.Error("failed to delete movie credit", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeCreditNotFound, "credit not found")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "credit successfully deleted",
+	})
+}
@@ -0,0 +1,245 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type personResponse struct {
+	Person storage.Person `json:"person"`
+}
+
+func createTestPerson(t *testing.T, e *echo.Echo, name string) storage.Person {
+	t.Helper()
+
+	rec := serve(t, e, testRequest{method: http.MethodPost, target: "/v1/people", token: "admin", body: fmt.Sprintf(`{"name":%q}`, name)})
+	assertStatus(t, rec, http.StatusOK)
+	return decode[personResponse](t, rec).Person
+}
+
+func TestGetPerson(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	person := createTestPerson(t, e, "Barry Jenkins")
+	target := fmt.Sprintf("/v1/people/%d", person.ID)
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: target, token: "admin"})
+	assertStatus(t, rec, http.StatusOK)
+	if got := decode[personResponse](t, rec).Person; got.Name != "Barry Jenkins" || got.Version != 1 {
+		t.Fatalf("person = %+v", got)
+	}
+	etag := rec.Header().Get("ETag")
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodGet,
+		target:  target,
+		token:   "admin",
+		headers: map[string]string{"If-None-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusNotModified)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: "/v1/people/999", token: "admin"})
+	assertStatus(t, rec, http.StatusNotFound)
+	assertCode(t, rec, codePersonNotFound)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: target, token: "reader"})
+	assertStatus(t, rec, http.StatusForbidden)
+	assertCode(t, rec, codePermissionDenied)
+}
+
+func TestUpdatePerson(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	person := createTestPerson(t, e, "Barry Jenkins")
+	target := fmt.Sprintf("/v1/people/%d", person.ID)
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: target, token: "admin"})
+	etag := rec.Header().Get("ETag")
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodPatch,
+		target:  target,
+		token:   "admin",
+		body:    `{"name":"Barry Jenkins Jr."}`,
+		headers: map[string]string{"If-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusOK)
+	updated := decode[personResponse](t, rec).Person
+	if updated.Name != "Barry Jenkins Jr." || updated.Version != person.Version+1 {
+		t.Fatalf("updated person = %+v", updated)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Fatal("ETag did not change after update")
+	}
+
+	// The first ETag is stale now.
+	rec = serve(t, e, testRequest{
+		method:  http.MethodPatch,
+		target:  target,
+		token:   "admin",
+		body:    `{"name":"Someone else"}`,
+		headers: map[string]string{"If-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusPreconditionFailed)
+	assertCode(t, rec, codePreconditionFailed)
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodGet,
+		target:  target,
+		token:   "admin",
+		headers: map[string]string{"If-None-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusOK)
+	if got := decode[personResponse](t, rec).Person; got.Name != "Barry Jenkins Jr." {
+		t.Fatalf("person after a stale update = %+v", got)
+	}
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodPatch,
+		target:  "/v1/people/999",
+		token:   "admin",
+		body:    `{"name":"Nobody"}`,
+		headers: map[string]string{"If-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusPreconditionFailed)
+
+	rec = serve(t, e, testRequest{method: http.MethodPatch, target: target, token: "admin", body: `{"name":""}`})
+	assertStatus(t, rec, http.StatusUnprocessableEntity)
+}
+
+func TestDeletePerson(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	person := createTestPerson(t, e, "Barry Jenkins")
+	target := fmt.Sprintf("/v1/people/%d", person.ID)
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: target, token: "admin"})
+	stale := rec.Header().Get("ETag")
+	rec = serve(t, e, testRequest{method: http.MethodPatch, target: target, token: "admin", body: `{"name":"Barry Jenkins Jr."}`})
+	assertStatus(t, rec, http.StatusOK)
+	etag := rec.Header().Get("ETag")
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodDelete,
+		target:  target,
+		token:   "admin",
+		headers: map[string]string{"If-Match": stale},
+	})
+	assertStatus(t, rec, http.StatusPreconditionFailed)
+	assertCode(t, rec, codePreconditionFailed)
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodDelete,
+		target:  target,
+		token:   "admin",
+		headers: map[string]string{"If-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusOK)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: target, token: "admin"})
+	assertStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(t, e, testRequest{method: http.MethodDelete, target: target, token: "admin"})
+	assertStatus(t, rec, http.StatusNotFound)
+	assertCode(t, rec, codePersonNotFound)
+}
+
+func TestListPeople(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	createTestPerson(t, e, "Barry Jenkins")
+	createTestPerson(t, e, "Denis Villeneuve")
+	createTestPerson(t, e, "Mahershala Ali")
+
+	tests := []struct {
+		name  string
+		query string
+		names []string
+	}{
+		{name: "all", query: "", names: []string{"Barry Jenkins", "Denis Villeneuve", "Mahershala Ali"}},
+		{name: "empty name", query: "?name=", names: []string{"Barry Jenkins", "Denis Villeneuve", "Mahershala Ali"}},
+		{name: "name", query: "?name=JENK", names: []string{"Barry Jenkins"}},
+		{name: "no match", query: "?name=Kubrick"},
+		{name: "sort by name", query: "?sort=-name", names: []string{"Mahershala Ali", "Denis Villeneuve", "Barry Jenkins"}},
+		{name: "page", query: "?page=2&page_size=2", names: []string{"Mahershala Ali"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/people" + tt.query, token: "admin"})
+			assertStatus(t, rec, http.StatusOK)
+
+			var names []string
+			for _, person := range decode[struct {
+				People []storage.Person `json:"people"`
+			}](t, rec).People {
+				names = append(names, person.Name)
+			}
+			if !slices.Equal(names, tt.names) {
+				t.Fatalf("people = %v, want %v", names, tt.names)
+			}
+		})
+	}
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/people?sort=created_at", token: "admin"})
+	assertStatus(t, rec, http.StatusUnprocessableEntity)
+}
+
+func TestListMoviesByPerson(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	moonlightMovie := createTestMovie(t, e, moonlight)
+	arrival := createTestMovie(t, e, `{"title":"Arrival","year":2016,"runtime":"116 mins","genres":["drama","sci-fi"]}`)
+	createTestMovie(t, e, `{"title":"Alien","year":1979,"runtime":"117 mins","genres":["horror","sci-fi"]}`)
+	jenkins := createTestPerson(t, e, "Barry Jenkins")
+	ali := createTestPerson(t, e, "Mahershala Ali")
+	uncredited := createTestPerson(t, e, "Nobody")
+
+	for _, credit := range []struct {
+		movieID int64
+		body    string
+	}{
+		{movieID: moonlightMovie.ID, body: fmt.Sprintf(`{"person_id":%d,"role":"director"}`, jenkins.ID)},
+		{movieID: moonlightMovie.ID, body: fmt.Sprintf(`{"person_id":%d,"role":"actor","character":"Juan"}`, ali.ID)},
+		{movieID: arrival.ID, body: fmt.Sprintf(`{"person_id":%d,"role":"actor"}`, ali.ID)},
+	} {
+		rec := serve(t, e, testRequest{
+			method: http.MethodPost,
+			target: fmt.Sprintf("/v1/movies/%d/credits", credit.movieID),
+			token:  "admin",
+			body:   credit.body,
+		})
+		assertStatus(t, rec, http.StatusOK)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		titles []string
+	}{
+		{name: "director", query: fmt.Sprintf("?person=%d", jenkins.ID), titles: []string{"Moonlight"}},
+		{name: "actor", query: fmt.Sprintf("?person=%d&sort=title", ali.ID), titles: []string{"Arrival", "Moonlight"}},
+		{name: "with another filter", query: fmt.Sprintf("?person=%d&genres=sci-fi", ali.ID), titles: []string{"Arrival"}},
+		{name: "no credits", query: fmt.Sprintf("?person=%d", uncredited.ID)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/movies" + tt.query, token: "reader"})
+			assertStatus(t, rec, http.StatusOK)
+
+			var titles []string
+			for _, movie := range decode[struct {
+				Movies []storage.Movie `json:"movies"`
+			}](t, rec).Movies {
+				titles = append(titles, movie.Title)
+			}
+			if !slices.Equal(titles, tt.titles) {
+				t.Fatalf("titles = %v, want %v", titles, tt.titles)
+			}
+		})
+	}
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/movies?person=abc", token: "reader"})
+	assertStatus(t, rec, http.StatusBadRequest)
+}
@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) rateMovieHandler(c echo.Context) error {
+	log := s.log.With("handler", "rate movie")
+	var input struct {
+		MovieID int64 `param:"id"`
+		Rating  int32 `json:"rating"`
+	}
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+
+	user := (&AuthContext{c}).GetUser()
+	rating := &storage.Rating{
+		MovieID: input.MovieID,
+		UserID:  user.ID,
+		Rating:  input.Rating,
+	}
+	if err = c.Validate(rating); err != nil {
+		log.Warn("failed to validate rating", "error", err)
+		return err
+	}
+
+	summary, err := s.storage.RateMovie(c.Request().Context(), rating)
+	if err != nil {
+		log.Error("failed to rate movie", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"rating":  rating,
+		"summary": summary,
+	})
+}
+
+func (s *Server) deleteMovieRatingHandler(c echo.Context) error {
+	log := s.log.With("handler", "delete movie rating")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	user := (&AuthContext{c}).GetUser()
+	summary, err := s.storage.DeleteMovieRating(c.Request().Context(), id, user.ID)
+	if err != nil {
+		log.Error("failed to delete movie rating", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeRatingNotFound, "rating not found")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"summary": summary,
+	})
+}
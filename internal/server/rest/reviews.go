@@ -0,0 +1,327 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type reviewListInput struct {
+	Statuses     []string `query:"status" validate:"unique,dive,oneof=pending approved rejected"`
+	Page         int      `validate:"gt=0,max=10000000"`
+	PageSize     int      `validate:"gt=0,max=100"`
+	Sort         string   `validate:"safesort"`
+	SortSafelist []string
+}
+
+func (s *Server) createReviewHandler(c echo.Context) error {
+	log := s.log.With("handler", "create review")
+	var input struct {
+		MovieID int64  `param:"id"`
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+	}
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+
+	user := (&AuthContext{c}).GetUser()
+	review := &storage.Review{
+		MovieID: input.MovieID,
+		UserID:  user.ID,
+		Title:   input.Title,
+		Body:    input.Body,
+		Status:  storage.ReviewPending,
+	}
+	if err = c.Validate(review); err != nil {
+		log.Warn("failed to validate review", "error", err)
+		return err
+	}
+
+	err = s.storage.CreateReview(c.Request().Context(), review)
+	if err != nil {
+		log.Error("failed to create review", "error", err)
+		switch {
+		case errors.Is(err, storage.ErrRecordNotFound):
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+		case errors.Is(err, storage.ErrDuplicateReview):
+			return newAPIError(http.StatusConflict, codeDuplicateReview, "you have already reviewed this movie")
+		default:
+			return err
+		}
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/reviews/%d", review.ID))
+	return c.JSON(http.StatusOK, envelope{
+		"review": review,
+	})
+}
+
+// listMovieReviewsHandler is open to everyone. Anonymous users see approved
+// reviews, signed in users also see their own, and moderators see every
+// review, optionally narrowed by status.
+func (s *Server) listMovieReviewsHandler(c echo.Context) error {
+	log := s.log.With("handler", "list movie reviews")
+	var movieID int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &movieID).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	input, err := bindReviewList(c, storage.ReviewStatuses())
+	if err != nil {
+		log.Warn("failed to bind filters", "error", err)
+		return err
+	}
+
+	user := (&AuthContext{c}).GetUser()
+	query := storage.ReviewQuery{
+		MovieID:  movieID,
+		Statuses: []string{storage.ReviewApproved},
+	}
+	switch {
+	case user.IncludePermission("reviews:moderate"):
+		query.Statuses = input.Statuses
+	case !user.IsAnonymous():
+		query.AuthorID = user.ID
+	}
+
+	if _, err := s.storage.GetMovie(c.Request().Context(), movieID); err != nil {
+		log.Error("failed to get movie", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+		}
+		return err
+	}
+
+	reviews, metadata, err := s.storage.GetReviews(c.Request().Context(), query, reviewFilters(input))
+	if err != nil {
+		log.Error("failed to get reviews", "error", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"reviews":  reviews,
+		"metadata": metadata,
+	})
+}
+
+// listReviewsHandler is the moderation queue across all movies, pending
+// reviews by default.
+func (s *Server) listReviewsHandler(c echo.Context) error {
+	log := s.log.With("handler", "list reviews")
+	input, err := bindReviewList(c, []string{storage.ReviewPending})
+	if err != nil {
+		log.Warn("failed to bind filters", "error", err)
+		return err
+	}
+
+	query := storage.ReviewQuery{Statuses: input.Statuses}
+	reviews, metadata, err := s.storage.GetReviews(c.Request().Context(), query, reviewFilters(input))
+	if err != nil {
+		log.Error("failed to get reviews", "error", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"reviews":  reviews,
+		"metadata": metadata,
+	})
+}
+
+func (s *Server) updateReviewHandler(c echo.Context) error {
+	log := s.log.With("handler", "update review")
+	var input struct {
+		ID    int64   `param:"id"`
+		Title *string `json:"title"`
+		Body  *string `json:"body"`
+	}
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+
+	review, err := s.getReview(c, input.ID)
+	if err != nil {
+		log.Error("failed to get review", "error", err)
+		return err
+	}
+
+	user := (&AuthContext{c}).GetUser()
+	if review.UserID != user.ID {
+		log.Warn("user is not the author of the review", "user_id", user.ID, "review_id", review.ID)
+		return newAPIError(http.StatusForbidden, codePermissionDenied, "only the author can edit this review")
+	}
+
+	if input.Title != nil {
+		review.Title = *input.Title
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+	// An edited review has to be moderated again.
+	review.Status = storage.ReviewPending
+	review.ModeratedBy = nil
+
+	if err = c.Validate(review); err != nil {
+		log.Warn("failed to validate review", "error", err)
+		return err
+	}
+
+	err = s.storage.UpdateReview(c.Request().Context(), review)
+	if err != nil {
+		log.Error("failed to update review", "error", err)
+		return reviewUpdateError(err)
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"review": review,
+	})
+}
+
+func (s *Server) moderateReviewHandler(c echo.Context) error {
+	log := s.log.With("handler", "moderate review")
+	var input struct {
+		ID     int64  `param:"id"`
+		Status string `json:"status" validate:"required,oneof=pending approved rejected"`
+	}
+	err := c.Bind(&input)
+	if err != nil {
+		log.Warn("failed to bind input", "error", err)
+		return err
+	}
+	if err = c.Validate(input); err != nil {
+		log.Warn("failed to validate status", "error", err)
+		return err
+	}
+
+	review, err := s.getReview(c, input.ID)
+	if err != nil {
+		log.Error("failed to get review", "error", err)
+		return err
+	}
+
+	user := (&AuthContext{c}).GetUser()
+	review.Status = input.Status
+	review.ModeratedBy = &user.ID
+
+	err = s.storage.UpdateReview(c.Request().Context(), review)
+	if err != nil {
+		log.Error("failed to moderate review", "error", err)
+		return reviewUpdateError(err)
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"review": review,
+	})
+}
+
+func (s *Server) deleteReviewHandler(c echo.Context) error {
+	log := s.log.With("handler", "delete review")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	review, err := s.getReview(c, id)
+	if err != nil {
+		log.Error("failed to get review", "error", err)
+		return err
+	}
+
+	user := (&AuthContext{c}).GetUser()
+	if review.UserID != user.ID && !user.IncludePermission("reviews:moderate") {
+		log.Warn("user may not delete the review", "user_id", user.ID, "review_id", review.ID)
+		return newAPIError(http.StatusForbidden, codePermissionDenied, "only the author can delete this review")
+	}
+
+	err = s.storage.DeleteReview(c.Request().Context(), id)
+	if err != nil {
+		log.Error("failed to delete review", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeReviewNotFound, "review not found")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "review successfully deleted",
+	})
+}
+
+func (s *Server) getReview(c echo.Context, id int64) (*storage.Review, error) {
+	review, err := s.storage.GetReview(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return nil, newAPIError(http.StatusNotFound, codeReviewNotFound, "review not found")
+		}
+		return nil, err
+	}
+	return review, nil
+}
+
+func bindReviewList(c echo.Context, defaultStatuses []string) (reviewListInput, error) {
+	input := reviewListInput{
+		Page:     1,
+		PageSize: 20,
+		Sort:     "-created_at",
+	}
+	var statusParam string
+
+	errs := echo.QueryParamsBinder(c).
+		FailFast(false).
+		String("status", &statusParam).
+		Int("page", &input.Page).
+		Int("page_size", &input.PageSize).
+		String("sort", &input.Sort).
+		BindErrors()
+	if errs != nil {
+		return input, binderErrors(errs)
+	}
+
+	input.Statuses = defaultStatuses
+	if statusParam != "" {
+		input.Statuses = strings.Split(statusParam, ",")
+	}
+	input.SortSafelist = []string{"created_at", "-created_at"}
+
+	if err := c.Validate(input); err != nil {
+		return input, err
+	}
+
+	return input, nil
+}
+
+func reviewFilters(input reviewListInput) storage.Filters {
+	return storage.Filters{
+		Page:         input.Page,
+		PageSize:     input.PageSize,
+		Sort:         input.Sort,
+		SortSafelist: input.SortSafelist,
+	}
+}
+
+func reviewUpdateError(err error) error {
+	if errors.Is(err, storage.ErrEditConflict) {
+		return newAPIError(
+			http.StatusConflict,
+			codeEditConflict,
+			"unable to update the record due to an edit conflict, please try again",
+		)
+	}
+	return err
+}
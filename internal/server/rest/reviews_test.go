@@ -0,0 +1,246 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type reviewResponse struct {
+	Review storage.Review `json:"review"`
+}
+
+type reviewsResponse struct {
+	Reviews []storage.Review `json:"reviews"`
+}
+
+func createTestReview(t *testing.T, e *echo.Echo, movieID int64, token, title string) storage.Review {
+	t.Helper()
+
+	rec := serve(t, e, testRequest{
+		method: http.MethodPost,
+		target: fmt.Sprintf("/v1/movies/%d/reviews", movieID),
+		token:  token,
+		body:   fmt.Sprintf(`{"title":%q,"body":"Worth watching."}`, title),
+	})
+	assertStatus(t, rec, http.StatusOK)
+	return decode[reviewResponse](t, rec).Review
+}
+
+func moderateTestReview(t *testing.T, e *echo.Echo, id int64, status string) {
+	t.Helper()
+
+	rec := serve(t, e, testRequest{
+		method: http.MethodPut,
+		target: fmt.Sprintf("/v1/reviews/%d/status", id),
+		token:  "moderator",
+		body:   fmt.Sprintf(`{"status":%q}`, status),
+	})
+	assertStatus(t, rec, http.StatusOK)
+}
+
+func reviewTitles(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+
+	var titles []string
+	for _, review := range decode[reviewsResponse](t, rec).Reviews {
+		titles = append(titles, review.Title)
+	}
+	slices.Sort(titles)
+	return titles
+}
+
+func TestCreateReview(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	target := fmt.Sprintf("/v1/movies/%d/reviews", movie.ID)
+
+	review := createTestReview(t, e, movie.ID, "reader", "Quiet")
+	if review.Status != storage.ReviewPending || review.UserID != 2 || review.MovieID != movie.ID {
+		t.Fatalf("created review = %+v", review)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		body   string
+		status int
+		code   string
+	}{
+		{name: "second review", target: target, token: "reader", body: `{"title":"Again","body":"Still good."}`, status: http.StatusConflict, code: codeDuplicateReview},
+		{name: "missing body", target: target, token: "writer", body: `{"title":"Empty"}`, status: http.StatusUnprocessableEntity, code: codeValidationFailed},
+		{name: "unknown movie", target: "/v1/movies/999/reviews", token: "writer", body: `{"title":"Lost","body":"Where?"}`, status: http.StatusNotFound, code: codeMovieNotFound},
+		{name: "inactive user", target: target, token: "inactive", body: `{"title":"Hi","body":"Hello."}`, status: http.StatusForbidden, code: codeAccountNotActivated},
+		{name: "anonymous", target: target, body: `{"title":"Hi","body":"Hello."}`, status: http.StatusUnauthorized, code: codeAuthenticationRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: http.MethodPost, target: tt.target, token: tt.token, body: tt.body})
+			assertStatus(t, rec, tt.status)
+			assertCode(t, rec, tt.code)
+		})
+	}
+}
+
+func TestListMovieReviewsVisibility(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	target := fmt.Sprintf("/v1/movies/%d/reviews", movie.ID)
+
+	createTestReview(t, e, movie.ID, "reader", "Pending by reader")
+	approved := createTestReview(t, e, movie.ID, "writer", "Approved by writer")
+	rejected := createTestReview(t, e, movie.ID, "admin", "Rejected by admin")
+	moderateTestReview(t, e, approved.ID, storage.ReviewApproved)
+	moderateTestReview(t, e, rejected.ID, storage.ReviewRejected)
+
+	tests := []struct {
+		name   string
+		token  string
+		query  string
+		titles []string
+	}{
+		{name: "anonymous", titles: []string{"Approved by writer"}},
+		{name: "author of a pending review", token: "reader", titles: []string{"Approved by writer", "Pending by reader"}},
+		{name: "author of a rejected review", token: "admin", titles: []string{"Approved by writer", "Rejected by admin"}},
+		{name: "author of the approved review", token: "writer", titles: []string{"Approved by writer"}},
+		{
+			name:   "moderator",
+			token:  "moderator",
+			titles: []string{"Approved by writer", "Pending by reader", "Rejected by admin"},
+		},
+		{name: "moderator by status", token: "moderator", query: "?status=pending", titles: []string{"Pending by reader"}},
+		// Only moderators can pick statuses; everyone else keeps their view.
+		{name: "anonymous by status", query: "?status=pending", titles: []string{"Approved by writer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: http.MethodGet, target: target + tt.query, token: tt.token})
+			assertStatus(t, rec, http.StatusOK)
+			if got := reviewTitles(t, rec); !slices.Equal(got, tt.titles) {
+				t.Fatalf("reviews = %v, want %v", got, tt.titles)
+			}
+		})
+	}
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/movies/999/reviews"})
+	assertStatus(t, rec, http.StatusNotFound)
+	assertCode(t, rec, codeMovieNotFound)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: target + "?status=hidden", token: "moderator"})
+	assertStatus(t, rec, http.StatusUnprocessableEntity)
+}
+
+func TestModerationQueue(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	createTestReview(t, e, movie.ID, "reader", "Pending")
+	approved := createTestReview(t, e, movie.ID, "writer", "Approved")
+	moderateTestReview(t, e, approved.ID, storage.ReviewApproved)
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/reviews", token: "moderator"})
+	assertStatus(t, rec, http.StatusOK)
+	if got := reviewTitles(t, rec); !slices.Equal(got, []string{"Pending"}) {
+		t.Fatalf("queue = %v, want only the pending review", got)
+	}
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: "/v1/reviews", token: "reader"})
+	assertStatus(t, rec, http.StatusForbidden)
+	assertCode(t, rec, codePermissionDenied)
+
+	rec = serve(t, e, testRequest{
+		method: http.MethodPut,
+		target: fmt.Sprintf("/v1/reviews/%d/status", approved.ID),
+		token:  "writer",
+		body:   `{"status":"approved"}`,
+	})
+	assertStatus(t, rec, http.StatusForbidden)
+	assertCode(t, rec, codePermissionDenied)
+
+	rec = serve(t, e, testRequest{
+		method: http.MethodPut,
+		target: fmt.Sprintf("/v1/reviews/%d/status", approved.ID),
+		token:  "moderator",
+		body:   `{"status":"hidden"}`,
+	})
+	assertStatus(t, rec, http.StatusUnprocessableEntity)
+}
+
+func TestUpdateReview(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	review := createTestReview(t, e, movie.ID, "writer", "Approved")
+	moderateTestReview(t, e, review.ID, storage.ReviewApproved)
+	target := fmt.Sprintf("/v1/reviews/%d", review.ID)
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		status int
+		code   string
+	}{
+		{name: "another user", target: target, token: "reader", status: http.StatusForbidden, code: codePermissionDenied},
+		// Moderators moderate; they do not rewrite other people's reviews.
+		{name: "moderator", target: target, token: "moderator", status: http.StatusForbidden, code: codePermissionDenied},
+		{name: "anonymous", target: target, status: http.StatusUnauthorized, code: codeAuthenticationRequired},
+		{name: "unknown review", target: "/v1/reviews/999", token: "writer", status: http.StatusNotFound, code: codeReviewNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: http.MethodPatch, target: tt.target, token: tt.token, body: `{"title":"Rewritten"}`})
+			assertStatus(t, rec, tt.status)
+			assertCode(t, rec, tt.code)
+		})
+	}
+
+	rec := serve(t, e, testRequest{method: http.MethodPatch, target: target, token: "writer", body: `{"title":"Edited"}`})
+	assertStatus(t, rec, http.StatusOK)
+	got := decode[reviewResponse](t, rec).Review
+	if got.Title != "Edited" || got.Body != review.Body || got.Status != storage.ReviewPending || got.ModeratedBy != nil {
+		t.Fatalf("edited review = %+v, want it back in moderation", got)
+	}
+
+	// Back in moderation, so anonymous users no longer see it.
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: fmt.Sprintf("/v1/movies/%d/reviews", movie.ID)})
+	assertStatus(t, rec, http.StatusOK)
+	if titles := reviewTitles(t, rec); len(titles) != 0 {
+		t.Fatalf("anonymous users see %v", titles)
+	}
+}
+
+func TestDeleteReview(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	byWriter := createTestReview(t, e, movie.ID, "writer", "By writer")
+	byReader := createTestReview(t, e, movie.ID, "reader", "By reader")
+
+	tests := []struct {
+		name   string
+		id     int64
+		token  string
+		status int
+		code   string
+	}{
+		{name: "another user", id: byWriter.ID, token: "reader", status: http.StatusForbidden, code: codePermissionDenied},
+		{name: "author", id: byWriter.ID, token: "writer", status: http.StatusOK},
+		{name: "already deleted", id: byWriter.ID, token: "writer", status: http.StatusNotFound, code: codeReviewNotFound},
+		{name: "moderator", id: byReader.ID, token: "moderator", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, e, testRequest{method: http.MethodDelete, target: fmt.Sprintf("/v1/reviews/%d", tt.id), token: tt.token})
+			assertStatus(t, rec, tt.status)
+			if tt.code != "" {
+				assertCode(t, rec, tt.code)
+			}
+		})
+	}
+}
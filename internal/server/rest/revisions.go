@@ -0,0 +1,134 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) listMovieRevisionsHandler(c echo.Context) error {
+	log := s.log.With("handler", "list movie revisions")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	revisions, err := s.storage.GetMovieRevisions(c.Request().Context(), id)
+	if err != nil {
+		log.Error("failed to get movie revisions", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"revisions": revisions,
+	})
+}
+
+func (s *Server) getMovieRevisionHandler(c echo.Context) error {
+	log := s.log.With("handler", "get movie revision")
+	var id int64
+	var version int32
+	errs := echo.PathParamsBinder(c).
+		FailFast(false).
+		Int64("id", &id).
+		Int32("version", &version).
+		BindErrors()
+	if errs != nil {
+		log.Warn("failed to bind parameters", "error", errs)
+		return binderErrors(errs)
+	}
+
+	revision, err := s.storage.GetMovieRevision(c.Request().Context(), id, version)
+	if err != nil {
+		log.Error("failed to get movie revision", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeRevisionNotFound, "revision not found")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"revision": revision,
+	})
+}
+
+// revertMovieHandler writes the data of an earlier revision as a new version
+// of the movie. It is an ordinary update, so If-Match and edit conflicts
+// behave as they do for PATCH.
+func (s *Server) revertMovieHandler(c echo.Context) error {
+	log := s.log.With("handler", "revert movie")
+	var id int64
+	var version int32
+	errs := echo.PathParamsBinder(c).
+		FailFast(false).
+		Int64("id", &id).
+		Int32("version", &version).
+		BindErrors()
+	if errs != nil {
+		log.Warn("failed to bind parameters", "error", errs)
+		return binderErrors(errs)
+	}
+
+	ifMatch := c.Request().Header.Get("If-Match")
+	movie, err := s.storage.GetMovie(c.Request().Context(), id)
+	if err != nil {
+		log.Error("failed to get movie", "error", err)
+		switch {
+		case errors.Is(err, storage.ErrRecordNotFound) && ifMatch != "":
+			return preconditionFailedError()
+		case errors.Is(err, storage.ErrRecordNotFound):
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found")
+		default:
+			return err
+		}
+	}
+	if ifMatch != "" && !etagMatches(ifMatch, movieETag(movie), false) {
+		log.Warn("movie etag does not match", "if_match", ifMatch)
+		return preconditionFailedError()
+	}
+
+	revision, err := s.storage.GetMovieRevision(c.Request().Context(), id, version)
+	if err != nil {
+		log.Error("failed to get movie revision", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeRevisionNotFound, "revision not found")
+		}
+		return err
+	}
+
+	movie.Title = revision.Title
+	movie.Year = revision.Year
+	movie.Runtime = revision.Runtime
+	movie.Genres = revision.Genres
+
+	err = s.storage.UpdateMovie(c.Request().Context(), movie)
+	if err != nil {
+		log.Error("failed to revert movie", "error", err)
+		switch {
+		case errors.Is(err, storage.ErrEditConflict) && ifMatch != "":
+			return preconditionFailedError()
+		case errors.Is(err, storage.ErrEditConflict):
+			return newAPIError(
+				http.StatusConflict,
+				codeEditConflict,
+				"unable to update the record due to an edit conflict, please try again",
+			)
+		default:
+			return err
+		}
+	}
+
+	c.Response().Header().Set("ETag", movieETag(movie))
+	return c.JSON(http.StatusOK, envelope{
+		"movie": movie,
+	})
+}
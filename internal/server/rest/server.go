@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"log/slog"
 	"net"
@@ -11,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/AndreyChufelin/movies-api/internal/auth"
 	"github.com/AndreyChufelin/movies-api/internal/logger"
 	"github.com/AndreyChufelin/movies-api/internal/storage"
 	"github.com/AndreyChufelin/movies-api/pkg/validator"
@@ -27,19 +27,103 @@ type Server struct {
 	idleTimeout    time.Duration
 	readTimeout    time.Duration
 	writeTimout    time.Duration
+	queryTimeout   time.Duration
+	routeTimeouts  map[string]time.Duration
 	storage        Storage
 	limit          int
 	limiterEnabled bool
-	auth           *auth.Auth
+	auth           Authenticator
 	corsOrigins    []string
+	legacyErrors   bool
+	idempotencyTTL time.Duration
+	authDegraded   string
+}
+
+// Degraded modes decide what happens to authenticated requests while
+// movies-auth is unreachable.
+const (
+	// AuthDegradedReject answers 503.
+	AuthDegradedReject = "reject"
+	// AuthDegradedAnonymous serves read-only requests as the anonymous user
+	// and rejects the rest.
+	AuthDegradedAnonymous = "anonymous"
+)
+
+// Authenticator resolves a bearer token to the user it was issued to. It
+// reports storage.ErrInvalidToken for tokens it rejects and
+// storage.ErrAuthUnavailable when it cannot tell.
+type Authenticator interface {
+	Verify(ctx context.Context, token string) (*storage.User, error)
 }
 
 type Storage interface {
-	CreateMovie(movie *storage.Movie) error
-	GetMovie(id int64) (*storage.Movie, error)
-	UpdateMovie(movie *storage.Movie) error
-	DeleteMovie(id int64) error
-	GetAllMovies(title string, genres []string, filters storage.Filters) ([]*storage.Movie, storage.Metadata, error)
+	CreateMovie(ctx context.Context, movie *storage.Movie) error
+	GetMovie(ctx context.Context, id int64) (*storage.Movie, error)
+	UpdateMovie(ctx context.Context, movie *storage.Movie) error
+	DeleteMovie(ctx context.Context, id int64, version int32) error
+	GetAllMovies(
+		ctx context.Context,
+		title string,
+		genres []string,
+		filters storage.Filters,
+	) ([]*storage.Movie, storage.Metadata, error)
+	GetMovieFacets(
+		ctx context.Context,
+		title string,
+		genres []string,
+		filters storage.Filters,
+		facets []string,
+	) (storage.Facets, error)
+	ExportMovies(
+		ctx context.Context,
+		title string,
+		genres []string,
+		filters storage.Filters,
+		fn func(*storage.Movie) error,
+	) error
+	SuggestMovies(ctx context.Context, query string, limit int) ([]storage.Suggestion, error)
+	BatchMovies(ctx context.Context, ops []storage.BatchOperation, atomic bool) ([]storage.BatchResult, error)
+	GetMovieRevisions(ctx context.Context, movieID int64) ([]storage.Revision, error)
+	GetMovieRevision(ctx context.Context, movieID int64, version int32) (*storage.Revision, error)
+	GetDeletedMovies(ctx context.Context, filters storage.Filters) ([]*storage.DeletedMovie, storage.Metadata, error)
+	RestoreMovie(ctx context.Context, id int64) (*storage.Movie, error)
+	PurgeMovie(ctx context.Context, id int64) error
+	PurgeDeletedMovies(ctx context.Context, before time.Time) (int64, error)
+
+	CreatePerson(ctx context.Context, person *storage.Person) error
+	GetPerson(ctx context.Context, id int64) (*storage.Person, error)
+	GetAllPeople(ctx context.Context, name string, filters storage.Filters) ([]*storage.Person, storage.Metadata, error)
+	UpdatePerson(ctx context.Context, person *storage.Person) error
+	DeletePerson(ctx context.Context, id int64, version int32) error
+	GetMovieCredits(ctx context.Context, movieID int64) ([]storage.Credit, error)
+	GetFilmography(ctx context.Context, personID int64) ([]storage.Credit, error)
+	CreateMovieCredit(ctx context.Context, credit *storage.Credit) error
+	DeleteMovieCredit(ctx context.Context, movieID, creditID int64) error
+
+	RateMovie(ctx context.Context, rating *storage.Rating) (storage.RatingSummary, error)
+	DeleteMovieRating(ctx context.Context, movieID, userID int64) (storage.RatingSummary, error)
+
+	CreateReview(ctx context.Context, review *storage.Review) error
+	GetReview(ctx context.Context, id int64) (*storage.Review, error)
+	GetReviews(ctx context.Context, query storage.ReviewQuery, filters storage.Filters) ([]*storage.Review, storage.Metadata, error)
+	UpdateReview(ctx context.Context, review *storage.Review) error
+	DeleteReview(ctx context.Context, id int64) error
+
+	CreateList(ctx context.Context, list *storage.List) error
+	GetList(ctx context.Context, id int64) (*storage.List, error)
+	GetUserLists(ctx context.Context, userID int64, publicOnly bool) ([]*storage.List, error)
+	UpdateList(ctx context.Context, list *storage.List) error
+	DeleteList(ctx context.Context, id int64) error
+	GetListItems(ctx context.Context, listID int64, filters storage.Filters) ([]*storage.ListItem, storage.Metadata, error)
+	AddListItem(ctx context.Context, listID, movieID int64, position int32) (*storage.ListItem, error)
+	MoveListItem(ctx context.Context, listID, movieID int64, position int32) error
+	RemoveListItem(ctx context.Context, listID, movieID int64) error
+
+	CreateIdempotencyKey(ctx context.Context, record *storage.IdempotencyRecord) error
+	GetIdempotencyKey(ctx context.Context, userID int64, key string) (*storage.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, record *storage.IdempotencyRecord) error
+	DeleteIdempotencyKey(ctx context.Context, userID int64, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
 }
 
 type envelope map[string]interface{}
@@ -62,16 +146,21 @@ func (c *AuthContext) SetUser(user *storage.User) {
 
 func NewServer(
 	logger *logger.Logger,
-	auth *auth.Auth,
+	auth Authenticator,
 	host,
 	port string,
 	idleTimeout,
 	readTimeout,
-	writeTimeout time.Duration,
+	writeTimeout,
+	queryTimeout time.Duration,
+	routeTimeouts map[string]time.Duration,
 	storage Storage,
 	limit int,
 	limiterEnabled bool,
 	corsOrigins []string,
+	legacyErrors bool,
+	idempotencyTTL time.Duration,
+	authDegraded string,
 ) *Server {
 	return &Server{
 		log:            logger,
@@ -80,23 +169,45 @@ func NewServer(
 		idleTimeout:    idleTimeout,
 		readTimeout:    readTimeout,
 		writeTimout:    writeTimeout,
+		queryTimeout:   queryTimeout,
+		routeTimeouts:  routeTimeouts,
 		storage:        storage,
 		limit:          limit,
 		limiterEnabled: limiterEnabled,
 		corsOrigins:    corsOrigins,
+		legacyErrors:   legacyErrors,
+		idempotencyTTL: idempotencyTTL,
+		authDegraded:   authDegraded,
 	}
 }
 
 func (s *Server) Start() error {
+	e, err := s.newEcho()
+	if err != nil {
+		return err
+	}
+
+	s.e = e
+	s.log.Info("starting REST server")
+	err = e.Start(s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	return nil
+}
+
+// newEcho builds the router with all middleware and routes.
+func (s *Server) newEcho() (*echo.Echo, error) {
 	e := echo.New()
 
 	validator, err := NewValidator()
 	if err != nil {
-		return fmt.Errorf("failed to create validator: %w", err)
+		return nil, fmt.Errorf("failed to create validator: %w", err)
 	}
 	e.Binder = &CustomBinder{}
 	e.Validator = validator
-	e.HTTPErrorHandler = customHTTPErrorHandler
+	e.HTTPErrorHandler = s.customHTTPErrorHandler
 
 	if s.limiterEnabled {
 		e.Use(
@@ -127,28 +238,70 @@ func (s *Server) Start() error {
 		},
 	}))
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: s.corsOrigins,
-		AllowHeaders: []string{"Authorization", "Content-Type"},
+		AllowOrigins:  s.corsOrigins,
+		AllowHeaders:  []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key"},
+		ExposeHeaders: []string{"ETag", "Location", "Idempotent-Replayed"},
 	}))
 	e.Use(middleware.BodyLimit("1M"))
 	e.Use(s.authMiddleware)
 	m := e.Group("/v1/movies")
 	// m.Use(s.requireActivatedUser)
-	m.POST("", s.requirePermission("movies:write", s.createMovieHandler))
-	m.GET("/:id", s.requirePermission("movies:read", s.getMovieHandler))
-	m.GET("", s.requirePermission("movies:read", s.listMoviesHandler))
-	m.PATCH("/:id", s.requirePermission("movies:write", s.updateMovieHandler))
-	m.DELETE("/:id", s.requirePermission("movies:write", s.deleteMovieHandler))
-	e.GET("/v1/healthcheck", s.healthcheckHandler)
-
-	s.e = e
-	s.log.Info("starting REST server")
-	err = e.Start(s.addr)
-	if err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+	m.POST("", s.requirePermission("movies:write", s.idempotent(s.withTimeout("create_movie", s.createMovieHandler))))
+	m.POST("\\:batch", s.requirePermission("movies:write", s.withTimeout("batch_movies", s.batchMoviesHandler)))
+	m.GET("/:id", s.requirePermission("movies:read", s.withTimeout("get_movie", s.getMovieHandler)))
+	m.GET("", s.requirePermission("movies:read", s.withTimeout("list_movies", s.listMoviesHandler)))
+	m.GET("/export", s.requirePermission("movies:export", s.withTimeout("export_movies", s.exportMoviesHandler)))
+	m.GET("/trash", s.requirePermission("movies:write", s.withTimeout("list_deleted_movies", s.listDeletedMoviesHandler)))
+	m.DELETE("/trash/:id", s.requirePermission("movies:purge", s.withTimeout("purge_movie", s.purgeMovieHandler)))
+	m.GET("/suggest", s.requirePermission("movies:read", s.withTimeout("suggest_movies", s.suggestMoviesHandler)))
+	m.PATCH("/:id", s.requirePermission("movies:write", s.withTimeout("update_movie", s.updateMovieHandler)))
+	m.DELETE("/:id", s.requirePermission("movies:write", s.withTimeout("delete_movie", s.deleteMovieHandler)))
+	m.POST("/:id/restore", s.requirePermission("movies:write", s.withTimeout("restore_movie", s.restoreMovieHandler)))
+	m.GET("/:id/revisions", s.requirePermission("movies:read", s.withTimeout("list_movie_revisions", s.listMovieRevisionsHandler)))
+	m.GET("/:id/revisions/:version", s.requirePermission("movies:read", s.withTimeout("get_movie_revision", s.getMovieRevisionHandler)))
+	m.POST("/:id/revisions/:version/revert", s.requirePermission("movies:write", s.withTimeout("revert_movie", s.revertMovieHandler)))
+	m.GET("/:id/credits", s.requirePermission("people:read", s.withTimeout("list_movie_credits", s.listMovieCreditsHandler)))
+	m.POST("/:id/credits", s.requirePermission("people:write", s.withTimeout("create_movie_credit", s.createMovieCreditHandler)))
+	m.DELETE("/:id/credits/:credit_id", s.requirePermission("people:write", s.withTimeout("delete_movie_credit", s.deleteMovieCreditHandler)))
+	m.PUT("/:id/rating", s.requirePermission("movies:rate", s.withTimeout("rate_movie", s.rateMovieHandler)))
+	m.DELETE("/:id/rating", s.requirePermission("movies:rate", s.withTimeout("delete_movie_rating", s.deleteMovieRatingHandler)))
+	m.POST("/:id/reviews", s.requireActivatedUser(s.withTimeout("create_review", s.createReviewHandler)))
+	m.GET("/:id/reviews", s.withTimeout("list_movie_reviews", s.listMovieReviewsHandler))
+	r := e.Group("/v1/reviews")
+	r.GET("", s.requirePermission("reviews:moderate", s.withTimeout("list_reviews", s.listReviewsHandler)))
+	r.PATCH("/:id", s.requireActivatedUser(s.withTimeout("update_review", s.updateReviewHandler)))
+	r.DELETE("/:id", s.requireActivatedUser(s.withTimeout("delete_review", s.deleteReviewHandler)))
+	r.PUT("/:id/status", s.requirePermission("reviews:moderate", s.withTimeout("moderate_review", s.moderateReviewHandler)))
+	p := e.Group("/v1/people")
+	p.POST("", s.requirePermission("people:write", s.withTimeout("create_person", s.createPersonHandler)))
+	p.GET("", s.requirePermission("people:read", s.withTimeout("list_people", s.listPeopleHandler)))
+	p.GET("/:id", s.requirePermission("people:read", s.withTimeout("get_person", s.getPersonHandler)))
+	p.PATCH("/:id", s.requirePermission("people:write", s.withTimeout("update_person", s.updatePersonHandler)))
+	p.DELETE("/:id", s.requirePermission("people:write", s.withTimeout("delete_person", s.deletePersonHandler)))
+	p.GET("/:id/filmography", s.requirePermission("people:read", s.withTimeout("get_filmography", s.getFilmographyHandler)))
+	l := e.Group("/v1/me/lists")
+	l.GET("", s.requireActivatedUser(s.withTimeout("list_my_lists", s.listMyListsHandler)))
+	l.POST("", s.requireActivatedUser(s.withTimeout("create_list", s.createListHandler)))
+	l.GET("/:id", s.requireActivatedUser(s.withTimeout("get_my_list", s.getMyListHandler)))
+	l.PATCH("/:id", s.requireActivatedUser(s.withTimeout("update_list", s.updateListHandler)))
+	l.DELETE("/:id", s.requireActivatedUser(s.withTimeout("delete_list", s.deleteListHandler)))
+	l.GET("/:id/items", s.requireActivatedUser(s.withTimeout("list_my_list_items", s.listMyListItemsHandler)))
+	l.POST("/:id/items", s.requireActivatedUser(s.withTimeout("add_list_item", s.addListItemHandler)))
+	l.PATCH("/:id/items/:movie_id", s.requireActivatedUser(s.withTimeout("move_list_item", s.moveListItemHandler)))
+	l.DELETE("/:id/items/:movie_id", s.requireActivatedUser(s.withTimeout("remove_list_item", s.removeListItemHandler)))
+	u := e.Group("/v1/users")
+	u.GET("/:id/lists", s.withTimeout("list_user_lists", s.listUserListsHandler))
+	u.GET("/:id/lists/:list_id/items", s.withTimeout("list_user_list_items", s.listUserListItemsHandler))
+	if _, ok := s.auth.(TokenInvalidator); ok {
+		a := e.Group("/v1/auth/cache")
+		a.DELETE("/token", s.requireAuthenticatedUser(s.invalidateOwnTokenHandler))
+		a.DELETE("/users/:id", s.requirePermission("auth:admin", s.invalidateUserTokensHandler))
+		a.DELETE("", s.requirePermission("auth:admin", s.invalidateAllTokensHandler))
 	}
+	e.GET("/v1/healthcheck", s.healthcheckHandler)
+	e.GET("/debug/vars", s.requirePermission("metrics:read", echo.WrapHandler(expvar.Handler())))
 
-	return nil
+	return e, nil
 }
 
 func (s *Server) Stop(ctx context.Context) error {
@@ -184,20 +337,31 @@ func (s *Server) authMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		headerParts := strings.Split(authHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			s.log.Warn("token must be bearer")
-			return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+			return newAPIError(http.StatusUnauthorized, codeInvalidToken, "invalid token")
 		}
 		token := headerParts[1]
 
-		user, err := s.auth.Verify(context.TODO(), token)
-		if err != nil {
-			if errors.Is(err, storage.ErrInvalidToken) {
-				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+		user, err := s.auth.Verify(cc.Request().Context(), token)
+		switch {
+		case errors.Is(err, storage.ErrInvalidToken):
+			return newAPIError(http.StatusUnauthorized, codeInvalidToken, "invalid token")
+		case errors.Is(err, storage.ErrAuthUnavailable):
+			method := cc.Request().Method
+			if s.authDegraded == AuthDegradedAnonymous && (method == http.MethodGet || method == http.MethodHead) {
+				s.log.Warn("auth unavailable, serving request as anonymous user")
+				cc.Set("user", storage.AnonymousUser)
+				return next(cc)
 			}
-			return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+			return newAPIError(http.StatusServiceUnavailable, codeAuthUnavailable, "authentication is temporarily unavailable")
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return err
+		case err != nil:
+			return internalError()
 		}
 
 		s.log.Info("authenticate user", "user_id", user.ID)
 		cc.Set("user", user)
+		cc.SetRequest(cc.Request().WithContext(storage.ContextWithUser(cc.Request().Context(), user)))
 		return next(cc)
 	}
 }
@@ -208,7 +372,11 @@ func (s *Server) requireAuthenticatedUser(next echo.HandlerFunc) echo.HandlerFun
 		user := cc.GetUser()
 
 		if user.IsAnonymous() {
-			return echo.NewHTTPError(http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return newAPIError(
+				http.StatusUnauthorized,
+				codeAuthenticationRequired,
+				"you must be authenticated to access this resource",
+			)
 		}
 
 		return next(cc)
@@ -221,7 +389,7 @@ func (s *Server) requireActivatedUser(next echo.HandlerFunc) echo.HandlerFunc {
 		user := cc.GetUser()
 
 		if !user.Activated {
-			return echo.NewHTTPError(http.StatusForbidden, "your account must be activated")
+			return newAPIError(http.StatusForbidden, codeAccountNotActivated, "your account must be activated")
 		}
 		return next(cc)
 	}
@@ -233,7 +401,7 @@ func (s *Server) requirePermission(code string, next echo.HandlerFunc) echo.Hand
 		cc := AuthContext{c}
 		user := cc.GetUser()
 		if !user.IncludePermission(code) {
-			return echo.NewHTTPError(http.StatusForbidden, "not permitted")
+			return newAPIError(http.StatusForbidden, codePermissionDenied, "not permitted")
 		}
 
 		return next(cc)
@@ -242,26 +410,21 @@ func (s *Server) requirePermission(code string, next echo.HandlerFunc) echo.Hand
 	return s.requireActivatedUser(fn)
 }
 
-func customHTTPErrorHandler(err error, c echo.Context) {
-	if c.Response().Committed {
-		return
+func (s *Server) withTimeout(route string, next echo.HandlerFunc) echo.HandlerFunc {
+	timeout, ok := s.routeTimeouts[route]
+	if !ok {
+		timeout = s.queryTimeout
 	}
-
-	var he *echo.HTTPError
-	if ok := errors.As(err, &he); ok {
-		err := c.JSON(he.Code, envelope{
-			"error": he.Message,
-		})
-		if err != nil {
-			c.Logger().Error(err)
-		}
-		return
+	if timeout <= 0 {
+		return next
 	}
 
-	if err := c.JSON(http.StatusInternalServerError, envelope{
-		"error": "internal server error",
-	}); err != nil {
-		c.Logger().Error(err)
+	return func(c echo.Context) error {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+		defer cancel()
+		c.SetRequest(c.Request().WithContext(ctx))
+
+		return next(c)
 	}
 }
 
@@ -272,19 +435,18 @@ func (cb *CustomBinder) Bind(i interface{}, c echo.Context) (err error) {
 	if err := db.Bind(i, c); err != nil {
 		var jerr *json.UnmarshalTypeError
 		if ok := errors.As(err, &jerr); ok {
-			return echo.NewHTTPError(http.StatusBadRequest, validator.ValidationError{
+			return newFieldError(http.StatusBadRequest, codeInvalidParameter, validator.ValidationError{
 				Field:   jerr.Field,
 				Message: "invalid value",
 			})
 		}
 		if errors.Is(err, storage.ErrInvalidRuntimeFormat) {
-			return echo.NewHTTPError(http.StatusBadRequest, validator.ValidationError{
+			return newFieldError(http.StatusBadRequest, codeInvalidParameter, validator.ValidationError{
 				Field:   "runtime",
 				Message: "invalid value",
-			},
-			)
+			})
 		}
-		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+		return newAPIError(http.StatusBadRequest, codeBadRequest, "bad request")
 	}
 
 	return
@@ -0,0 +1,155 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/logger"
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/AndreyChufelin/movies-api/internal/storage/memory"
+	"github.com/labstack/echo/v4"
+)
+
+// staticAuth authenticates the tokens it knows and rejects the rest.
+type staticAuth map[string]*storage.User
+
+func (a staticAuth) Verify(_ context.Context, token string) (*storage.User, error) {
+	user, ok := a[token]
+	if !ok {
+		return nil, storage.ErrInvalidToken
+	}
+	return user, nil
+}
+
+var testUsers = staticAuth{
+	"admin": {
+		ID:        1,
+		Activated: true,
+		Permissions: []string{
+			"movies:read", "movies:write", "movies:purge", "movies:rate", "people:read", "people:write",
+		},
+	},
+	"reader":    {ID: 2, Activated: true, Permissions: []string{"movies:read"}},
+	"inactive":  {ID: 3, Activated: false, Permissions: []string{"movies:read"}},
+	"writer":    {ID: 4, Activated: true, Permissions: []string{"movies:read"}},
+	"moderator": {ID: 5, Activated: true, Permissions: []string{"movies:read", "reviews:moderate"}},
+}
+
+func newTestLogger() *logger.Logger {
+	return &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+// newTestServer returns the router of a server backed by the in-memory
+// storage.
+func newTestServer(t *testing.T, auth Authenticator) *echo.Echo {
+	t.Helper()
+
+	s := NewServer(
+		newTestLogger(),
+		auth,
+		"",
+		"0",
+		0,
+		0,
+		0,
+		time.Second,
+		nil,
+		memory.NewStorage(),
+		0,
+		false,
+		nil,
+		false,
+		time.Hour,
+		AuthDegradedReject,
+	)
+	e, err := s.newEcho()
+	if err != nil {
+		t.Fatalf("failed to build server: %v", err)
+	}
+	return e
+}
+
+type testRequest struct {
+	method  string
+	target  string
+	token   string
+	body    string
+	headers map[string]string
+}
+
+func serve(t *testing.T, e *echo.Echo, req testRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body io.Reader
+	if req.body != "" {
+		body = strings.NewReader(req.body)
+	}
+	r := httptest.NewRequest(req.method, req.target, body)
+	if req.body != "" {
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	if req.token != "" {
+		r.Header.Set("Authorization", "Bearer "+req.token)
+	}
+	for k, v := range req.headers {
+		r.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, r)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	err := json.Unmarshal(rec.Body.Bytes(), &v)
+	if err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func assertStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+func assertCode(t *testing.T, rec *httptest.ResponseRecorder, want string) {
+	t.Helper()
+
+	p := decode[problem](t, rec)
+	if p.Code != want {
+		t.Fatalf("code = %q, want %q", p.Code, want)
+	}
+}
+
+type movieResponse struct {
+	Movie storage.Movie `json:"movie"`
+}
+
+func createTestMovie(t *testing.T, e *echo.Echo, body string) storage.Movie {
+	t.Helper()
+
+	rec := serve(t, e, testRequest{method: http.MethodPost, target: "/v1/movies", token: "admin", body: body})
+	assertStatus(t, rec, http.StatusOK)
+	return decode[movieResponse](t, rec).Movie
+}
+
+func TestHealthcheck(t *testing.T) {
+	e := newTestServer(t, testUsers)
+
+	rec := serve(t, e, testRequest{method: http.MethodGet, target: "/v1/healthcheck"})
+	assertStatus(t, rec, http.StatusOK)
+}
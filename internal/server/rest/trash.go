@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) listDeletedMoviesHandler(c echo.Context) error {
+	log := s.log.With("handler", "list deleted movies")
+	var input struct {
+		Page     int `validate:"gt=0,max=10000000"`
+		PageSize int `validate:"gt=0,max=100"`
+	}
+	input.Page = 1
+	input.PageSize = 20
+
+	errs := echo.QueryParamsBinder(c).
+		FailFast(false).
+		Int("page", &input.Page).
+		Int("page_size", &input.PageSize).
+		BindErrors()
+	if errs != nil {
+		log.Warn("failed to bind parameters", "error", errs)
+		return binderErrors(errs)
+	}
+
+	if err := c.Validate(input); err != nil {
+		log.Warn("failed to validate parameters", "error", err)
+		return err
+	}
+
+	movies, metadata, err := s.storage.GetDeletedMovies(c.Request().Context(), storage.Filters{
+		Page:     input.Page,
+		PageSize: input.PageSize,
+	})
+	if err != nil {
+		log.Error("failed to get deleted movies", "error", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"movies":   movies,
+		"metadata": metadata,
+	})
+}
+
+func (s *Server) restoreMovieHandler(c echo.Context) error {
+	log := s.log.With("handler", "restore movie")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	movie, err := s.storage.RestoreMovie(c.Request().Context(), id)
+	if err != nil {
+		log.Error("failed to restore movie", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found in trash")
+		}
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	c.Response().Header().Set("ETag", movieETag(movie))
+	return c.JSON(http.StatusOK, envelope{
+		"movie": movie,
+	})
+}
+
+func (s *Server) purgeMovieHandler(c echo.Context) error {
+	log := s.log.With("handler", "purge movie")
+	var id int64
+	err := echo.PathParamsBinder(c).
+		Int64("id", &id).
+		BindError()
+	if err != nil {
+		log.Warn("failed to bind parameters", "error", err)
+		return binderError(err)
+	}
+
+	err = s.storage.PurgeMovie(c.Request().Context(), id)
+	if err != nil {
+		log.Error("failed to purge movie", "error", err)
+		if errors.Is(err, storage.ErrRecordNotFound) {
+			return newAPIError(http.StatusNotFound, codeMovieNotFound, "movie not found in trash")
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "movie permanently deleted",
+	})
+}
@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+func TestRestoreMovieKeepsVersionAndRevisions(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+	target := fmt.Sprintf("/v1/movies/%d", movie.ID)
+
+	rec := serve(t, e, testRequest{method: http.MethodPatch, target: target, token: "admin", body: `{"title":"Moonlight (2016)"}`})
+	assertStatus(t, rec, http.StatusOK)
+	etag := rec.Header().Get("ETag")
+
+	rec = serve(t, e, testRequest{method: http.MethodDelete, target: target, token: "admin"})
+	assertStatus(t, rec, http.StatusOK)
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: target, token: "reader"})
+	assertStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(t, e, testRequest{method: http.MethodPost, target: target + "/restore", token: "admin"})
+	assertStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("ETag"); got != etag {
+		t.Fatalf("ETag after restore = %s, want %s", got, etag)
+	}
+	if got := decode[movieResponse](t, rec).Movie; got.Version != 2 || got.Title != "Moonlight (2016)" {
+		t.Fatalf("restored movie = %+v", got)
+	}
+
+	rec = serve(t, e, testRequest{
+		method:  http.MethodGet,
+		target:  target,
+		token:   "reader",
+		headers: map[string]string{"If-None-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusNotModified)
+
+	rec = serve(t, e, testRequest{method: http.MethodGet, target: target + "/revisions", token: "reader"})
+	assertStatus(t, rec, http.StatusOK)
+	revisions := decode[struct {
+		Revisions []storage.Revision `json:"revisions"`
+	}](t, rec).Revisions
+	if len(revisions) != 2 {
+		t.Fatalf("revisions = %+v, want 2", revisions)
+	}
+	for i, want := range []struct {
+		version int32
+		title   string
+	}{
+		{version: 2, title: "Moonlight (2016)"},
+		{version: 1, title: "Moonlight"},
+	} {
+		got := revisions[i]
+		if got.Version != want.version || got.Title != want.title || got.Year != movie.Year ||
+			!slices.Equal(got.Genres, movie.Genres) || got.UserID == nil || *got.UserID != 1 {
+			t.Fatalf("revision %d = %+v, want version %d titled %q", i, got, want.version, want.title)
+		}
+	}
+
+	// The ETag from before the delete still guards edits.
+	rec = serve(t, e, testRequest{
+		method:  http.MethodPatch,
+		target:  target,
+		token:   "admin",
+		body:    `{"year":2017}`,
+		headers: map[string]string{"If-Match": etag},
+	})
+	assertStatus(t, rec, http.StatusOK)
+}
+
+func TestRestoreMovieNotInTrash(t *testing.T) {
+	e := newTestServer(t, testUsers)
+	movie := createTestMovie(t, e, moonlight)
+
+	rec := serve(t, e, testRequest{method: http.MethodPost, target: fmt.Sprintf("/v1/movies/%d/restore", movie.ID), token: "admin"})
+	assertStatus(t, rec, http.StatusNotFound)
+	assertCode(t, rec, codeMovieNotFound)
+}
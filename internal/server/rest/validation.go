@@ -6,7 +6,6 @@ import (
 	"net/http"
 
 	"github.com/AndreyChufelin/movies-api/pkg/validator"
-	"github.com/labstack/echo/v4"
 )
 
 type CustomValidator struct {
@@ -17,7 +16,7 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 	err := cv.validator.Validate(i)
 	var validationErrs *validator.ValidationErrors
 	if errors.As(err, &validationErrs) {
-		return echo.NewHTTPError(http.StatusUnprocessableEntity, validationErrs.Errors)
+		return newFieldErrors(http.StatusUnprocessableEntity, codeValidationFailed, validationErrs.Errors)
 	}
 	return err
 }
@@ -0,0 +1,37 @@
+package storage
+
+import "errors"
+
+// ErrBatchAborted marks operations of an atomic batch that were not applied
+// because another operation in the batch failed.
+var ErrBatchAborted = errors.New("batch aborted")
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// BatchOperation is one step of a bulk write. Create and update carry the
+// full movie; update and delete check Version, which delete may leave zero.
+type BatchOperation struct {
+	Op      string
+	Movie   *Movie
+	ID      int64
+	Version int32
+}
+
+type BatchResult struct {
+	Movie *Movie
+	Err   error
+}
+
+// AbortBatch fails every result of an atomic batch that has not failed on
+// its own.
+func AbortBatch(results []BatchResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = BatchResult{Err: ErrBatchAborted}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at the last row a client has seen. Value holds the sort
+// column of that row and ID breaks ties, so the next page starts right after
+// it regardless of rows inserted or deleted in between.
+type Cursor struct {
+	Sort     string `json:"s"`
+	Value    string `json:"v"`
+	ID       int64  `json:"id"`
+	Backward bool   `json:"b,omitempty"`
+	Fuzzy    bool   `json:"f,omitempty"`
+}
+
+func NewCursor(filters Filters, movie *Movie, backward bool) Cursor {
+	return Cursor{
+		Sort:     filters.Sort,
+		Value:    movie.sortValue(strings.TrimPrefix(filters.Sort, "-")),
+		ID:       movie.ID,
+		Backward: backward,
+		Fuzzy:    filters.Fuzzy,
+	}
+}
+
+func (c Cursor) Encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic("failed to marshal cursor: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort == "" || cursor.ID < 1 {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func (m *Movie) sortValue(column string) string {
+	switch column {
+	case "title":
+		return m.Title
+	case "year":
+		return strconv.FormatInt(int64(m.Year), 10)
+	case "runtime":
+		return strconv.FormatInt(int64(m.Runtime), 10)
+	case "relevance":
+		return strconv.FormatFloat(float64(m.Rank), 'g', -1, 32)
+	case "rating":
+		return strconv.FormatFloat(m.AverageRating, 'g', -1, 64)
+	default:
+		return strconv.FormatInt(m.ID, 10)
+	}
+}
+
+// NewPage turns the rows fetched for filters into a page and its metadata.
+// Storages fetch one row more than PageSize so that NewPage can tell whether
+// another page follows; in backward cursor mode rows come in reverse order.
+func NewPage(movies []*Movie, totalRecords int, filters Filters) ([]*Movie, Metadata) {
+	backward := filters.Cursor != nil && filters.Cursor.Backward
+	hasMore := len(movies) > filters.PageSize
+	if hasMore {
+		movies = movies[:filters.PageSize]
+	}
+	if backward {
+		slices.Reverse(movies)
+	}
+
+	var metadata Metadata
+	switch {
+	case filters.Cursor != nil:
+		metadata = Metadata{PageSize: filters.PageSize}
+		if filters.IncludeTotal {
+			metadata.TotalRecords = totalRecords
+		}
+	case filters.IncludeTotal:
+		metadata = NewMetadata(totalRecords, filters.Page, filters.PageSize)
+	case len(movies) > 0:
+		metadata = Metadata{
+			CurrentPage: filters.Page,
+			PageSize:    filters.PageSize,
+			FirstPage:   1,
+		}
+	}
+
+	if len(movies) == 0 {
+		return movies, metadata
+	}
+	metadata.Fuzzy = filters.Fuzzy
+	first, last := movies[0], movies[len(movies)-1]
+
+	hasNext := hasMore
+	hasPrev := filters.Cursor != nil || filters.Page > 1
+	if backward {
+		hasNext, hasPrev = true, hasMore
+	}
+	if hasNext {
+		metadata.NextCursor = NewCursor(filters, last, false).Encode()
+	}
+	if hasPrev {
+		metadata.PrevCursor = NewCursor(filters, first, true).Encode()
+	}
+
+	return movies, metadata
+}
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var ErrDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+
+// IdempotencyRecord remembers the response to a request sent with an
+// Idempotency-Key header. Status stays zero while the request is in flight.
+type IdempotencyRecord struct {
+	UserID      int64
+	Key         string
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
@@ -0,0 +1,17 @@
+package storage
+
+// ImportRecord is a movie loaded in bulk, identified by the key it has in
+// the source it was exported from.
+type ImportRecord struct {
+	ExternalID string
+	Movie      Movie
+}
+
+type ImportStats struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	// Skipped counts records whose movie is in the trash. They are left
+	// alone until the movie is restored or purged.
+	Skipped int `json:"skipped"`
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrDuplicateList     = errors.New("duplicate list")
+	ErrDuplicateListItem = errors.New("duplicate list item")
+)
+
+const (
+	ListWatchlist = "watchlist"
+	ListFavorites = "favorites"
+	ListCustom    = "custom"
+)
+
+// List is a user's collection of movies. A user has at most one watchlist
+// and one favorites list and any number of custom lists.
+type List struct {
+	ID        int64     `db:"id" json:"id"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	Kind      string    `db:"kind" json:"kind" validate:"required,oneof=watchlist favorites custom"`
+	Name      string    `db:"name" json:"name" validate:"required,lt=200"`
+	Public    bool      `db:"public" json:"public"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	Version   int32     `db:"version" json:"version"`
+}
+
+// ListItem is a movie at Position, counted from 1, in a list.
+type ListItem struct {
+	Position int32     `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Movie    Movie     `json:"movie"`
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"maps"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+func (s *Storage) BatchMovies(
+	ctx context.Context,
+	ops []storage.BatchOperation,
+	atomic bool,
+) ([]storage.BatchResult, error) {
+	if !atomic {
+		return s.batchMoviesEach(ctx, ops)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Hold the lock for the whole batch and restore the snapshot on failure,
+	// the in-memory equivalent of a transaction.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := maps.Clone(s.movies)
+	revisions := maps.Clone(s.revisions)
+	deleted := maps.Clone(s.deleted)
+	lastID := s.lastID
+	userID := storage.ActingUserID(ctx)
+
+	results := make([]storage.BatchResult, len(ops))
+	failed := false
+	for i, op := range ops {
+		results[i] = s.applyBatchOperation(op, userID)
+		if results[i].Err != nil {
+			failed = true
+		}
+	}
+
+	if failed {
+		s.movies = snapshot
+		s.revisions = revisions
+		s.deleted = deleted
+		s.lastID = lastID
+		storage.AbortBatch(results)
+	}
+
+	return results, nil
+}
+
+func (s *Storage) batchMoviesEach(ctx context.Context, ops []storage.BatchOperation) ([]storage.BatchResult, error) {
+	results := make([]storage.BatchResult, len(ops))
+	userID := storage.ActingUserID(ctx)
+	for i, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		results[i] = s.applyBatchOperation(op, userID)
+		s.mu.Unlock()
+	}
+
+	return results, nil
+}
+
+// applyBatchOperation must be called with s.mu held.
+func (s *Storage) applyBatchOperation(op storage.BatchOperation, userID *int64) storage.BatchResult {
+	switch op.Op {
+	case storage.BatchCreate:
+		movie := *op.Movie
+		s.createMovie(&movie, userID)
+		return storage.BatchResult{Movie: &movie}
+	case storage.BatchUpdate:
+		movie := *op.Movie
+		if err := s.updateMovie(&movie, userID); err != nil {
+			return storage.BatchResult{Err: err}
+		}
+		return storage.BatchResult{Movie: &movie}
+	case storage.BatchDelete:
+		if err := s.deleteMovie(op.ID, op.Version); err != nil {
+			return storage.BatchResult{Err: err}
+		}
+		return storage.BatchResult{}
+	default:
+		panic("unknown batch operation: " + op.Op)
+	}
+}
@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+type idempotencyKey struct {
+	userID int64
+	key    string
+}
+
+func (s *Storage) CreateIdempotencyKey(ctx context.Context, record *storage.IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	k := idempotencyKey{userID: record.UserID, key: record.Key}
+	if existing, ok := s.idempotencyKeys[k]; ok && existing.ExpiresAt.After(now) {
+		return storage.ErrDuplicateIdempotencyKey
+	}
+
+	record.CreatedAt = now.Truncate(time.Second)
+	s.idempotencyKeys[k] = storage.IdempotencyRecord{
+		UserID:      record.UserID,
+		Key:         record.Key,
+		Fingerprint: record.Fingerprint,
+		CreatedAt:   record.CreatedAt,
+		ExpiresAt:   record.ExpiresAt,
+	}
+
+	return nil
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, userID int64, key string) (*storage.IdempotencyRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.idempotencyKeys[idempotencyKey{userID: userID, key: key}]
+	if !ok || !record.ExpiresAt.After(time.Now()) {
+		return nil, storage.ErrRecordNotFound
+	}
+	record.Header = record.Header.Clone()
+	record.Body = slices.Clone(record.Body)
+
+	return &record, nil
+}
+
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, record *storage.IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{userID: record.UserID, key: record.Key}
+	existing, ok := s.idempotencyKeys[k]
+	if !ok {
+		return storage.ErrRecordNotFound
+	}
+	existing.Status = record.Status
+	existing.Header = record.Header.Clone()
+	existing.Body = slices.Clone(record.Body)
+	s.idempotencyKeys[k] = existing
+
+	return nil
+}
+
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, userID int64, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotencyKeys, idempotencyKey{userID: userID, key: key})
+
+	return nil
+}
+
+func (s *Storage) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	before := len(s.idempotencyKeys)
+	maps.DeleteFunc(s.idempotencyKeys, func(_ idempotencyKey, record storage.IdempotencyRecord) bool {
+		return !record.ExpiresAt.After(now)
+	})
+
+	return int64(before - len(s.idempotencyKeys)), nil
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+// ImportMovies upserts the records by external ID. Movies in the trash are
+// skipped rather than rewritten, as in the postgres backend.
+func (s *Storage) ImportMovies(ctx context.Context, records []storage.ImportRecord) (storage.ImportStats, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.ImportStats{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID := storage.ActingUserID(ctx)
+	var stats storage.ImportStats
+	for _, r := range records {
+		movie := copyMovie(r.Movie)
+
+		id, ok := s.externalIDs[r.ExternalID]
+		if !ok {
+			s.createMovie(&movie, userID)
+			s.externalIDs[r.ExternalID] = movie.ID
+			stats.Inserted++
+			continue
+		}
+		if _, trashed := s.deleted[id]; trashed {
+			stats.Skipped++
+			continue
+		}
+
+		current := s.movies[id]
+		if current.Title == movie.Title &&
+			current.Year == movie.Year &&
+			current.Runtime == movie.Runtime &&
+			slices.Equal(current.Genres, movie.Genres) {
+			stats.Unchanged++
+			continue
+		}
+		movie.ID = id
+		movie.Version = current.Version
+		err := s.updateMovie(&movie, userID)
+		if err != nil {
+			return storage.ImportStats{}, err
+		}
+		stats.Updated++
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+func TestImportMovies(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+	record := func(id, title string) storage.ImportRecord {
+		return storage.ImportRecord{
+			ExternalID: id,
+			Movie:      storage.Movie{Title: title, Year: 2016, Runtime: 111, Genres: []string{"drama"}},
+		}
+	}
+
+	stats, err := s.ImportMovies(ctx, []storage.ImportRecord{record("a", "Moonlight"), record("b", "Arrival")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (storage.ImportStats{Inserted: 2}) {
+		t.Fatalf("first import stats = %+v", stats)
+	}
+
+	trashed := s.externalIDs["b"]
+	if err := s.DeleteMovie(ctx, trashed, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err = s.ImportMovies(ctx, []storage.ImportRecord{
+		record("a", "Moonlight"),
+		record("b", "Arrival (2016)"),
+		record("c", "Alien"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (storage.ImportStats{Inserted: 1, Unchanged: 1, Skipped: 1}) {
+		t.Fatalf("second import stats = %+v", stats)
+	}
+	if got := s.deleted[trashed].Title; got != "Arrival" {
+		t.Fatalf("trashed movie was rewritten to %q", got)
+	}
+
+	stats, err = s.ImportMovies(ctx, []storage.ImportRecord{record("a", "Moonlight (2016)")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (storage.ImportStats{Updated: 1}) {
+		t.Fatalf("third import stats = %+v", stats)
+	}
+	movie, err := s.GetMovie(ctx, s.externalIDs["a"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Title != "Moonlight (2016)" || movie.Version != 2 {
+		t.Fatalf("updated movie = %+v", movie)
+	}
+
+	if err := s.PurgeMovie(ctx, trashed); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = s.ImportMovies(ctx, []storage.ImportRecord{record("b", "Arrival")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (storage.ImportStats{Inserted: 1}) {
+		t.Fatalf("import after purge stats = %+v", stats)
+	}
+}
@@ -0,0 +1,243 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+type listItem struct {
+	movieID int64
+	addedAt time.Time
+}
+
+func (s *Storage) CreateList(ctx context.Context, list *storage.List) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if list.Kind != storage.ListCustom {
+		for _, existing := range s.lists {
+			if existing.UserID == list.UserID && existing.Kind == list.Kind {
+				return storage.ErrDuplicateList
+			}
+		}
+	}
+
+	s.lastListID++
+	list.ID = s.lastListID
+	list.CreatedAt = time.Now().Truncate(time.Second)
+	list.Version = 1
+	s.lists[list.ID] = *list
+
+	return nil
+}
+
+func (s *Storage) GetList(ctx context.Context, id int64) (*storage.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, ok := s.lists[id]
+	if !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+
+	return &list, nil
+}
+
+func (s *Storage) GetUserLists(ctx context.Context, userID int64, publicOnly bool) ([]*storage.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lists := []*storage.List{}
+	for _, list := range s.lists {
+		if list.UserID == userID && (list.Public || !publicOnly) {
+			lists = append(lists, &list)
+		}
+	}
+	slices.SortFunc(lists, func(a, b *storage.List) int {
+		aCustom, bCustom := a.Kind == storage.ListCustom, b.Kind == storage.ListCustom
+		switch {
+		case aCustom != bCustom && aCustom:
+			return 1
+		case aCustom != bCustom:
+			return -1
+		}
+		return cmp.Or(cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.ID, b.ID))
+	})
+
+	return lists, nil
+}
+
+func (s *Storage) UpdateList(ctx context.Context, list *storage.List) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.lists[list.ID]
+	if !ok || current.Version != list.Version {
+		return storage.ErrEditConflict
+	}
+
+	current.Name = list.Name
+	current.Public = list.Public
+	current.Version++
+	s.lists[list.ID] = current
+	list.Version = current.Version
+
+	return nil
+}
+
+func (s *Storage) DeleteList(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lists[id]; !ok {
+		return storage.ErrRecordNotFound
+	}
+	delete(s.lists, id)
+	delete(s.listItems, id)
+
+	return nil
+}
+
+func (s *Storage) GetListItems(
+	ctx context.Context,
+	listID int64,
+	filters storage.Filters,
+) (
+	[]*storage.ListItem,
+	storage.Metadata,
+	error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.Metadata{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	visible := []*storage.ListItem{}
+	for i, item := range s.listItems[listID] {
+		movie, ok := s.movies[item.movieID]
+		if !ok {
+			continue
+		}
+		visible = append(visible, &storage.ListItem{
+			Position: int32(i + 1),
+			AddedAt:  item.addedAt,
+			Movie:    copyMovie(movie),
+		})
+	}
+
+	start := min(filters.Offset(), len(visible))
+	end := min(start+filters.PageSize, len(visible))
+	items := visible[start:end]
+
+	totalRecords := len(visible)
+	if len(items) == 0 {
+		totalRecords = 0
+	}
+	return items, storage.NewMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (s *Storage) AddListItem(ctx context.Context, listID, movieID int64, position int32) (*storage.ListItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lists[listID]; !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+	movie, ok := s.movies[movieID]
+	if !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+	items := s.listItems[listID]
+	if slices.ContainsFunc(items, func(item listItem) bool { return item.movieID == movieID }) {
+		return nil, storage.ErrDuplicateListItem
+	}
+
+	count := int32(len(items))
+	if position < 1 || position > count+1 {
+		position = count + 1
+	}
+	item := listItem{movieID: movieID, addedAt: time.Now().Truncate(time.Second)}
+	s.listItems[listID] = slices.Insert(items, int(position-1), item)
+
+	return &storage.ListItem{
+		Position: position,
+		AddedAt:  item.addedAt,
+		Movie:    copyMovie(movie),
+	}, nil
+}
+
+func (s *Storage) MoveListItem(ctx context.Context, listID, movieID int64, position int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lists[listID]; !ok {
+		return storage.ErrRecordNotFound
+	}
+	items := s.listItems[listID]
+	i := slices.IndexFunc(items, func(item listItem) bool { return item.movieID == movieID })
+	if i < 0 {
+		return storage.ErrRecordNotFound
+	}
+
+	item := items[i]
+	items = slices.Delete(items, i, i+1)
+	position = max(1, min(position, int32(len(items)+1)))
+	s.listItems[listID] = slices.Insert(items, int(position-1), item)
+
+	return nil
+}
+
+func (s *Storage) RemoveListItem(ctx context.Context, listID, movieID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lists[listID]; !ok {
+		return storage.ErrRecordNotFound
+	}
+	items := s.listItems[listID]
+	i := slices.IndexFunc(items, func(item listItem) bool { return item.movieID == movieID })
+	if i < 0 {
+		return storage.ErrRecordNotFound
+	}
+	s.listItems[listID] = slices.Delete(items, i, i+1)
+
+	return nil
+}
@@ -0,0 +1,496 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+func (s *Storage) CreateMovie(ctx context.Context, movie *storage.Movie) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.createMovie(movie, storage.ActingUserID(ctx))
+
+	return nil
+}
+
+func (s *Storage) createMovie(movie *storage.Movie, userID *int64) {
+	s.lastID++
+	movie.ID = s.lastID
+	movie.CreatedAt = time.Now().Truncate(time.Second)
+	movie.Version = 1
+	s.movies[movie.ID] = copyMovie(*movie)
+	s.addRevision(*movie, userID)
+}
+
+func (s *Storage) GetMovie(ctx context.Context, id int64) (*storage.Movie, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	movie, ok := s.movies[id]
+	if !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+	movie = copyMovie(movie)
+
+	return &movie, nil
+}
+
+func (s *Storage) GetAllMovies(
+	ctx context.Context,
+	title string,
+	genres []string,
+	filters storage.Filters,
+) (
+	[]*storage.Movie,
+	storage.Metadata,
+	error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.Metadata{}, err
+	}
+
+	movies, totalRecords, err := s.queryMovies(title, genres, filters)
+	if err != nil {
+		return nil, storage.Metadata{}, err
+	}
+
+	if len(movies) == 0 && title != "" && !filters.Fuzzy && filters.Cursor == nil && filters.Page == 1 {
+		filters.Fuzzy = true
+		movies, totalRecords, err = s.queryMovies(title, genres, filters)
+		if err != nil {
+			return nil, storage.Metadata{}, err
+		}
+	}
+
+	movies, metadata := storage.NewPage(movies, totalRecords, filters)
+	return movies, metadata, nil
+}
+
+func (s *Storage) queryMovies(title string, genres []string, filters storage.Filters) ([]*storage.Movie, int, error) {
+	matched := s.matchMovies(title, genres, filters)
+	sortMovies(matched, filters)
+
+	totalRecords := len(matched)
+	offset := filters.Offset()
+	if filters.Cursor != nil {
+		var err error
+		matched, err = afterCursor(matched, filters)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset = 0
+	}
+	start := min(offset, len(matched))
+	end := min(start+filters.PageSize+1, len(matched))
+
+	movies := []*storage.Movie{}
+	for i := start; i < end; i++ {
+		movies = append(movies, &matched[i])
+	}
+
+	// Mirror count(*) OVER(): a page past the end carries no rows to count from.
+	if len(movies) == 0 && filters.Cursor == nil {
+		totalRecords = 0
+	}
+	return movies, totalRecords, nil
+}
+
+// matchMovies returns copies of the movies that pass the title search and
+// filters, in no particular order.
+func (s *Storage) matchMovies(title string, genres []string, filters storage.Filters) []storage.Movie {
+	query := parseSearchQuery(title)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := []storage.Movie{}
+	for _, movie := range s.movies {
+		if !matchFilters(movie, genres, filters) {
+			continue
+		}
+		if filters.PersonID != 0 && !s.hasCredit(movie.ID, filters.PersonID) {
+			continue
+		}
+
+		movie = copyMovie(movie)
+		switch {
+		case title == "":
+		case filters.Fuzzy:
+			movie.Rank = similarity(movie.Title, title)
+			if movie.Rank <= similarityThreshold {
+				continue
+			}
+		default:
+			ok, rank := query.match(movie.Title)
+			if !ok {
+				continue
+			}
+			movie.Rank = rank
+			movie.Highlight = query.highlight(movie.Title)
+		}
+		matched = append(matched, movie)
+	}
+
+	return matched
+}
+
+func (s *Storage) ExportMovies(
+	ctx context.Context,
+	title string,
+	genres []string,
+	filters storage.Filters,
+	fn func(*storage.Movie) error,
+) error {
+	matched := s.matchMovies(title, genres, filters)
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].ID < matched[j].ID
+	})
+
+	for i := range matched {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		matched[i].Rank, matched[i].Highlight = 0, ""
+		if err := fn(&matched[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) SuggestMovies(ctx context.Context, query string, limit int) ([]storage.Suggestion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		suggestion storage.Suggestion
+		prefix     bool
+		similarity float32
+	}
+
+	prefix := strings.ToLower(query)
+	candidates := []candidate{}
+	s.mu.RLock()
+	for _, movie := range s.movies {
+		c := candidate{
+			suggestion: storage.Suggestion{ID: movie.ID, Title: movie.Title},
+			prefix:     strings.HasPrefix(strings.ToLower(movie.Title), prefix),
+			similarity: similarity(movie.Title, query),
+		}
+		if c.prefix || c.similarity > similarityThreshold {
+			candidates = append(candidates, c)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.prefix != b.prefix {
+			return a.prefix
+		}
+		if a.similarity != b.similarity {
+			return a.similarity > b.similarity
+		}
+		return a.suggestion.Title < b.suggestion.Title
+	})
+
+	suggestions := []storage.Suggestion{}
+	for _, c := range candidates[:min(limit, len(candidates))] {
+		suggestions = append(suggestions, c.suggestion)
+	}
+	return suggestions, nil
+}
+
+func (s *Storage) GetMovieFacets(
+	ctx context.Context,
+	title string,
+	genres []string,
+	filters storage.Filters,
+	facets []string,
+) (storage.Facets, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.Facets{}, err
+	}
+
+	matched := s.matchMovies(title, genres, filters)
+
+	var result storage.Facets
+	for _, facet := range facets {
+		counts := map[string]int{}
+		var order []string
+		count := func(value string) {
+			if _, ok := counts[value]; !ok {
+				order = append(order, value)
+			}
+			counts[value]++
+		}
+
+		switch facet {
+		case "genres":
+			for _, movie := range matched {
+				for _, genre := range movie.Genres {
+					count(genre)
+				}
+			}
+		case "year":
+			sortMovies(matched, storage.Filters{Sort: "year", SortSafelist: []string{"year"}})
+			for _, movie := range matched {
+				count(storage.DecadeLabel(movie.Year))
+			}
+		case "runtime":
+			sortMovies(matched, storage.Filters{Sort: "runtime", SortSafelist: []string{"runtime"}})
+			for _, movie := range matched {
+				count(storage.RuntimeBucketLabel(storage.RuntimeBucket(movie.Runtime)))
+			}
+		default:
+			panic("unknown facet: " + facet)
+		}
+
+		if facet == "genres" {
+			sort.SliceStable(order, func(i, j int) bool {
+				if counts[order[i]] != counts[order[j]] {
+					return counts[order[i]] > counts[order[j]]
+				}
+				return order[i] < order[j]
+			})
+		}
+
+		values := []storage.FacetCount{}
+		for _, value := range order {
+			values = append(values, storage.FacetCount{Value: value, Count: counts[value]})
+		}
+		switch facet {
+		case "genres":
+			result.Genres = values
+		case "year":
+			result.Year = values
+		case "runtime":
+			result.Runtime = values
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Storage) UpdateMovie(ctx context.Context, movie *storage.Movie) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateMovie(movie, storage.ActingUserID(ctx))
+}
+
+func (s *Storage) updateMovie(movie *storage.Movie, userID *int64) error {
+	current, ok := s.movies[movie.ID]
+	if !ok || current.Version != movie.Version {
+		return storage.ErrEditConflict
+	}
+
+	movie.Version++
+	movie.CreatedAt = current.CreatedAt
+	movie.AverageRating = current.AverageRating
+	movie.RatingsCount = current.RatingsCount
+	s.movies[movie.ID] = copyMovie(*movie)
+	s.addRevision(*movie, userID)
+
+	return nil
+}
+
+func (s *Storage) DeleteMovie(ctx context.Context, id int64, version int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteMovie(id, version)
+}
+
+func (s *Storage) deleteMovie(id int64, version int32) error {
+	movie, ok := s.movies[id]
+	if !ok {
+		return storage.ErrRecordNotFound
+	}
+	if version != 0 && movie.Version != version {
+		return storage.ErrEditConflict
+	}
+	delete(s.movies, id)
+	s.deleted[id] = storage.DeletedMovie{
+		Movie:     movie,
+		DeletedAt: time.Now().Truncate(time.Second),
+	}
+
+	return nil
+}
+
+func copyMovie(movie storage.Movie) storage.Movie {
+	movie.Genres = slices.Clone(movie.Genres)
+	return movie
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+func matchFilters(movie storage.Movie, genres []string, filters storage.Filters) bool {
+	switch {
+	case filters.YearFrom != 0 && movie.Year < filters.YearFrom,
+		filters.YearTo != 0 && movie.Year > filters.YearTo,
+		filters.RuntimeMin != 0 && movie.Runtime < storage.Runtime(filters.RuntimeMin),
+		filters.RuntimeMax != 0 && movie.Runtime > storage.Runtime(filters.RuntimeMax),
+		filters.MinRating != 0 && movie.AverageRating < filters.MinRating:
+		return false
+	}
+
+	for _, genre := range filters.ExcludedGenres {
+		if slices.Contains(movie.Genres, genre) {
+			return false
+		}
+	}
+
+	if len(genres) == 0 {
+		return true
+	}
+	matched := 0
+	for _, genre := range genres {
+		if slices.Contains(movie.Genres, genre) {
+			matched++
+		}
+	}
+	if filters.GenresMatch == "any" {
+		return matched > 0
+	}
+	return matched == len(genres)
+}
+
+func sortMovies(movies []storage.Movie, filters storage.Filters) {
+	column := sortColumn(filters)
+	desc := sortDescending(filters)
+
+	sort.SliceStable(movies, func(i, j int) bool {
+		return compareMovies(movies[i], movies[j], column, desc) < 0
+	})
+}
+
+func compareMovies(a, b storage.Movie, column string, desc bool) int {
+	c := compareColumn(a, b, column)
+	if c == 0 {
+		return cmp.Compare(a.ID, b.ID)
+	}
+	if desc {
+		return -c
+	}
+	return c
+}
+
+// afterCursor keeps the movies that follow the cursor in sort order. For a
+// backward cursor it keeps the preceding ones, closest first.
+func afterCursor(movies []storage.Movie, filters storage.Filters) ([]storage.Movie, error) {
+	column := sortColumn(filters)
+	desc := sortDescending(filters)
+	pivot, err := cursorMovie(column, filters.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []storage.Movie{}
+	for _, movie := range movies {
+		c := compareMovies(movie, pivot, column, desc)
+		if (!filters.Cursor.Backward && c > 0) || (filters.Cursor.Backward && c < 0) {
+			result = append(result, movie)
+		}
+	}
+	if filters.Cursor.Backward {
+		slices.Reverse(result)
+	}
+	return result, nil
+}
+
+func cursorMovie(column string, cursor *storage.Cursor) (storage.Movie, error) {
+	movie := storage.Movie{ID: cursor.ID}
+	switch column {
+	case "title":
+		movie.Title = cursor.Value
+		return movie, nil
+	case "relevance":
+		rank, err := strconv.ParseFloat(cursor.Value, 32)
+		if err != nil {
+			return storage.Movie{}, storage.ErrInvalidCursor
+		}
+		movie.Rank = float32(rank)
+		return movie, nil
+	case "rating":
+		rating, err := strconv.ParseFloat(cursor.Value, 64)
+		if err != nil {
+			return storage.Movie{}, storage.ErrInvalidCursor
+		}
+		movie.AverageRating = rating
+		return movie, nil
+	}
+
+	value, err := strconv.ParseInt(cursor.Value, 10, 64)
+	if err != nil {
+		return storage.Movie{}, storage.ErrInvalidCursor
+	}
+	switch column {
+	case "year":
+		movie.Year = int32(value)
+	case "runtime":
+		movie.Runtime = storage.Runtime(value)
+	}
+	return movie, nil
+}
+
+func compareColumn(a, b storage.Movie, column string) int {
+	switch column {
+	case "title":
+		return cmp.Compare(a.Title, b.Title)
+	case "year":
+		return cmp.Compare(a.Year, b.Year)
+	case "runtime":
+		return cmp.Compare(a.Runtime, b.Runtime)
+	case "relevance":
+		return cmp.Compare(a.Rank, b.Rank)
+	case "rating":
+		return cmp.Compare(a.AverageRating, b.AverageRating)
+	default:
+		return cmp.Compare(a.ID, b.ID)
+	}
+}
+
+func sortDescending(filters storage.Filters) bool {
+	return strings.HasPrefix(filters.Sort, "-") || filters.Sort == "relevance"
+}
+
+func sortColumn(filters storage.Filters) string {
+	for _, safeValue := range filters.SortSafelist {
+		if filters.Sort == safeValue {
+			return strings.TrimPrefix(filters.Sort, "-")
+		}
+	}
+	panic("unsafe sort parameter: " + filters.Sort)
+}
@@ -0,0 +1,261 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+func (s *Storage) CreatePerson(ctx context.Context, person *storage.Person) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastPersonID++
+	person.ID = s.lastPersonID
+	person.CreatedAt = time.Now().Truncate(time.Second)
+	person.Version = 1
+	s.people[person.ID] = *person
+
+	return nil
+}
+
+func (s *Storage) GetPerson(ctx context.Context, id int64) (*storage.Person, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	person, ok := s.people[id]
+	if !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+
+	return &person, nil
+}
+
+func (s *Storage) GetAllPeople(
+	ctx context.Context,
+	name string,
+	filters storage.Filters,
+) (
+	[]*storage.Person,
+	storage.Metadata,
+	error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.Metadata{}, err
+	}
+
+	name = strings.ToLower(name)
+	s.mu.RLock()
+	matched := []storage.Person{}
+	for _, person := range s.people {
+		if strings.Contains(strings.ToLower(person.Name), name) {
+			matched = append(matched, person)
+		}
+	}
+	s.mu.RUnlock()
+
+	desc := strings.HasPrefix(filters.Sort, "-")
+	column := strings.TrimPrefix(filters.Sort, "-")
+	slices.SortFunc(matched, func(a, b storage.Person) int {
+		var c int
+		if column == "name" {
+			c = cmp.Compare(a.Name, b.Name)
+		} else {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		return c
+	})
+
+	start := min(filters.Offset(), len(matched))
+	end := min(start+filters.PageSize, len(matched))
+	people := []*storage.Person{}
+	for i := start; i < end; i++ {
+		people = append(people, &matched[i])
+	}
+
+	totalRecords := len(matched)
+	if len(people) == 0 {
+		totalRecords = 0
+	}
+	return people, storage.NewMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (s *Storage) UpdatePerson(ctx context.Context, person *storage.Person) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.people[person.ID]
+	if !ok || current.Version != person.Version {
+		return storage.ErrEditConflict
+	}
+
+	person.Version++
+	person.CreatedAt = current.CreatedAt
+	s.people[person.ID] = *person
+
+	return nil
+}
+
+func (s *Storage) DeletePerson(ctx context.Context, id int64, version int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	person, ok := s.people[id]
+	if !ok {
+		return storage.ErrRecordNotFound
+	}
+	if version != 0 && person.Version != version {
+		return storage.ErrEditConflict
+	}
+	delete(s.people, id)
+	for creditID, credit := range s.credits {
+		if credit.PersonID == id {
+			delete(s.credits, creditID)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) GetMovieCredits(ctx context.Context, movieID int64) ([]storage.Credit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.movies[movieID]; !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+
+	credits := []storage.Credit{}
+	for _, credit := range s.credits {
+		if credit.MovieID == movieID {
+			credit.PersonName = s.people[credit.PersonID].Name
+			credits = append(credits, credit)
+		}
+	}
+	slices.SortFunc(credits, func(a, b storage.Credit) int {
+		return cmp.Or(cmp.Compare(a.BillingOrder, b.BillingOrder), cmp.Compare(a.ID, b.ID))
+	})
+
+	return credits, nil
+}
+
+func (s *Storage) GetFilmography(ctx context.Context, personID int64) ([]storage.Credit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.people[personID]; !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+
+	credits := []storage.Credit{}
+	for _, credit := range s.credits {
+		movie, ok := s.movies[credit.MovieID]
+		if credit.PersonID != personID || !ok {
+			continue
+		}
+		credit.MovieTitle = movie.Title
+		credit.MovieYear = movie.Year
+		credits = append(credits, credit)
+	}
+	slices.SortFunc(credits, func(a, b storage.Credit) int {
+		return cmp.Or(
+			cmp.Compare(b.MovieYear, a.MovieYear),
+			cmp.Compare(a.MovieID, b.MovieID),
+			cmp.Compare(a.BillingOrder, b.BillingOrder),
+		)
+	})
+
+	return credits, nil
+}
+
+func (s *Storage) CreateMovieCredit(ctx context.Context, credit *storage.Credit) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, movieOK := s.movies[credit.MovieID]
+	_, personOK := s.people[credit.PersonID]
+	if !movieOK || !personOK {
+		return storage.ErrRecordNotFound
+	}
+	for _, existing := range s.credits {
+		if existing.MovieID == credit.MovieID &&
+			existing.PersonID == credit.PersonID &&
+			existing.Role == credit.Role &&
+			existing.Character == credit.Character {
+			return storage.ErrDuplicateCredit
+		}
+	}
+
+	s.lastCreditID++
+	credit.ID = s.lastCreditID
+	stored := *credit
+	stored.PersonName, stored.MovieTitle, stored.MovieYear = "", "", 0
+	s.credits[credit.ID] = stored
+
+	return nil
+}
+
+func (s *Storage) DeleteMovieCredit(ctx context.Context, movieID, creditID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credit, ok := s.credits[creditID]
+	if !ok || credit.MovieID != movieID {
+		return storage.ErrRecordNotFound
+	}
+	delete(s.credits, creditID)
+
+	return nil
+}
+
+// hasCredit must be called with s.mu held.
+func (s *Storage) hasCredit(movieID, personID int64) bool {
+	for _, credit := range s.credits {
+		if credit.MovieID == movieID && credit.PersonID == personID {
+			return true
+		}
+	}
+	return false
+}
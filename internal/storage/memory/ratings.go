@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+type ratingKey struct {
+	movieID int64
+	userID  int64
+}
+
+func (s *Storage) RateMovie(ctx context.Context, rating *storage.Rating) (storage.RatingSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.RatingSummary{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[rating.MovieID]; !ok {
+		return storage.RatingSummary{}, storage.ErrRecordNotFound
+	}
+
+	rating.UpdatedAt = time.Now().Truncate(time.Second)
+	s.ratings[ratingKey{rating.MovieID, rating.UserID}] = *rating
+
+	return s.updateRatingSummary(rating.MovieID), nil
+}
+
+func (s *Storage) DeleteMovieRating(ctx context.Context, movieID, userID int64) (storage.RatingSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.RatingSummary{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := ratingKey{movieID, userID}
+	if _, ok := s.ratings[key]; !ok {
+		return storage.RatingSummary{}, storage.ErrRecordNotFound
+	}
+	if _, ok := s.movies[movieID]; !ok {
+		return storage.RatingSummary{}, storage.ErrRecordNotFound
+	}
+	delete(s.ratings, key)
+
+	return s.updateRatingSummary(movieID), nil
+}
+
+// updateRatingSummary must be called with s.mu held.
+func (s *Storage) updateRatingSummary(movieID int64) storage.RatingSummary {
+	var sum, count int32
+	for key, rating := range s.ratings {
+		if key.movieID == movieID {
+			sum += rating.Rating
+			count++
+		}
+	}
+
+	var summary storage.RatingSummary
+	if count > 0 {
+		summary.AverageRating = math.Round(float64(sum)/float64(count)*100) / 100
+		summary.RatingsCount = count
+	}
+
+	movie := s.movies[movieID]
+	movie.AverageRating = summary.AverageRating
+	movie.RatingsCount = summary.RatingsCount
+	s.movies[movieID] = movie
+
+	return summary
+}
@@ -0,0 +1,149 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+func (s *Storage) CreateReview(ctx context.Context, review *storage.Review) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[review.MovieID]; !ok {
+		return storage.ErrRecordNotFound
+	}
+	for _, existing := range s.reviews {
+		if existing.MovieID == review.MovieID && existing.UserID == review.UserID {
+			return storage.ErrDuplicateReview
+		}
+	}
+
+	s.lastReviewID++
+	now := time.Now().Truncate(time.Second)
+	review.ID = s.lastReviewID
+	review.Status = storage.ReviewPending
+	review.ModeratedBy = nil
+	review.CreatedAt = now
+	review.UpdatedAt = now
+	review.Version = 1
+	s.reviews[review.ID] = *review
+
+	return nil
+}
+
+func (s *Storage) GetReview(ctx context.Context, id int64) (*storage.Review, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	review, ok := s.reviews[id]
+	if !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+	if _, ok := s.movies[review.MovieID]; !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+
+	return &review, nil
+}
+
+func (s *Storage) GetReviews(
+	ctx context.Context,
+	reviewQuery storage.ReviewQuery,
+	filters storage.Filters,
+) (
+	[]*storage.Review,
+	storage.Metadata,
+	error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.Metadata{}, err
+	}
+
+	s.mu.RLock()
+	matched := []storage.Review{}
+	for _, review := range s.reviews {
+		if _, ok := s.movies[review.MovieID]; !ok {
+			continue
+		}
+		if reviewQuery.MovieID != 0 && review.MovieID != reviewQuery.MovieID {
+			continue
+		}
+		if !slices.Contains(reviewQuery.Statuses, review.Status) &&
+			(reviewQuery.AuthorID == 0 || review.UserID != reviewQuery.AuthorID) {
+			continue
+		}
+		matched = append(matched, review)
+	}
+	s.mu.RUnlock()
+
+	desc := strings.HasPrefix(filters.Sort, "-")
+	slices.SortFunc(matched, func(a, b storage.Review) int {
+		c := a.CreatedAt.Compare(b.CreatedAt)
+		if desc {
+			c = -c
+		}
+		return cmp.Or(c, cmp.Compare(a.ID, b.ID))
+	})
+
+	start := min(filters.Offset(), len(matched))
+	end := min(start+filters.PageSize, len(matched))
+	reviews := []*storage.Review{}
+	for i := start; i < end; i++ {
+		reviews = append(reviews, &matched[i])
+	}
+
+	totalRecords := len(matched)
+	if len(reviews) == 0 {
+		totalRecords = 0
+	}
+	return reviews, storage.NewMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (s *Storage) UpdateReview(ctx context.Context, review *storage.Review) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.reviews[review.ID]
+	if !ok || current.Version != review.Version {
+		return storage.ErrEditConflict
+	}
+
+	review.Version++
+	review.UpdatedAt = time.Now().Truncate(time.Second)
+	s.reviews[review.ID] = *review
+
+	return nil
+}
+
+func (s *Storage) DeleteReview(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reviews[id]; !ok {
+		return storage.ErrRecordNotFound
+	}
+	delete(s.reviews, id)
+
+	return nil
+}
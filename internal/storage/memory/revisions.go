@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+func (s *Storage) GetMovieRevisions(ctx context.Context, movieID int64) ([]storage.Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions, ok := s.revisions[movieID]
+	if !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+
+	result := make([]storage.Revision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		result = append(result, copyRevision(revisions[i]))
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetMovieRevision(ctx context.Context, movieID int64, version int32) (*storage.Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, revision := range s.revisions[movieID] {
+		if revision.Version == version {
+			revision = copyRevision(revision)
+			return &revision, nil
+		}
+	}
+
+	return nil, storage.ErrRecordNotFound
+}
+
+// addRevision must be called with s.mu held.
+func (s *Storage) addRevision(movie storage.Movie, userID *int64) {
+	s.revisions[movie.ID] = append(s.revisions[movie.ID], storage.Revision{
+		MovieID:   movie.ID,
+		Version:   movie.Version,
+		Title:     movie.Title,
+		Year:      movie.Year,
+		Runtime:   movie.Runtime,
+		Genres:    slices.Clone(movie.Genres),
+		UserID:    userID,
+		CreatedAt: time.Now().Truncate(time.Second),
+	})
+}
+
+func copyRevision(revision storage.Revision) storage.Revision {
+	revision.Genres = slices.Clone(revision.Genres)
+	return revision
+}
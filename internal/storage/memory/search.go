@@ -0,0 +1,189 @@
+package memory
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// similarityThreshold is the pg_trgm default used by the % operator.
+const similarityThreshold = 0.3
+
+type searchTerm struct {
+	words  []string
+	negate bool
+}
+
+// searchQuery approximates websearch_to_tsquery('simple', ...): terms in a
+// group are ANDed, groups are separated by OR, quoted text is a phrase and a
+// leading minus negates a term.
+type searchQuery struct {
+	groups [][]searchTerm
+}
+
+func parseSearchQuery(s string) searchQuery {
+	var query searchQuery
+	group := []searchTerm{}
+
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		var raw string
+		negate := false
+		if strings.HasPrefix(rest, "-") {
+			negate = true
+			rest = rest[1:]
+		}
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				raw, rest = rest[1:], ""
+			} else {
+				raw, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				raw, rest = rest, ""
+			} else {
+				raw, rest = rest[:end], rest[end:]
+			}
+		}
+		rest = strings.TrimSpace(rest)
+
+		if !negate && strings.EqualFold(raw, "or") {
+			if len(group) > 0 {
+				query.groups = append(query.groups, group)
+				group = []searchTerm{}
+			}
+			continue
+		}
+		if words := tokenize(raw); len(words) > 0 {
+			group = append(group, searchTerm{words: words, negate: negate})
+		}
+	}
+	if len(group) > 0 {
+		query.groups = append(query.groups, group)
+	}
+
+	return query
+}
+
+// match reports whether title satisfies the query and ranks it by the share
+// of title words hit by the query.
+func (q searchQuery) match(title string) (bool, float32) {
+	if len(q.groups) == 0 {
+		return true, 0
+	}
+
+	titleWords := tokenize(title)
+	matched := false
+	for _, group := range q.groups {
+		if groupMatches(group, titleWords) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false, 0
+	}
+
+	positive := q.positiveWords()
+	hits := 0
+	for _, word := range titleWords {
+		if slices.Contains(positive, word) {
+			hits++
+		}
+	}
+	return true, float32(hits) / float32(len(titleWords))
+}
+
+func groupMatches(group []searchTerm, titleWords []string) bool {
+	for _, term := range group {
+		if containsPhrase(titleWords, term.words) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func containsPhrase(words, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(phrase)], phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q searchQuery) positiveWords() []string {
+	var words []string
+	for _, group := range q.groups {
+		for _, term := range group {
+			if !term.negate {
+				words = append(words, term.words...)
+			}
+		}
+	}
+	return words
+}
+
+// highlight wraps the title words hit by the query the same way ts_headline
+// does by default.
+func (q searchQuery) highlight(title string) string {
+	positive := q.positiveWords()
+
+	var b strings.Builder
+	runes := []rune(title)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		if slices.Contains(positive, strings.ToLower(word)) {
+			b.WriteString("<b>" + word + "</b>")
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// similarity follows pg_trgm: the share of trigrams two strings have in common.
+func similarity(a, b string) float32 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	common := 0
+	for trigram := range ta {
+		if _, ok := tb[trigram]; ok {
+			common++
+		}
+	}
+	return float32(common) / float32(len(ta)+len(tb)-common)
+}
+
+func trigrams(s string) map[string]struct{} {
+	result := make(map[string]struct{})
+	for _, word := range tokenize(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			result[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return result
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
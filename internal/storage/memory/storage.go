@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+type Storage struct {
+	mu     sync.RWMutex
+	movies map[int64]storage.Movie
+	lastID int64
+
+	revisions map[int64][]storage.Revision
+	// externalIDs maps the keys of imported movies to their IDs.
+	externalIDs map[string]int64
+	// deleted holds the trash, out of movies so reads never see it.
+	deleted map[int64]storage.DeletedMovie
+
+	people       map[int64]storage.Person
+	lastPersonID int64
+	credits      map[int64]storage.Credit
+	lastCreditID int64
+
+	ratings map[ratingKey]storage.Rating
+
+	reviews      map[int64]storage.Review
+	lastReviewID int64
+
+	lists      map[int64]storage.List
+	lastListID int64
+	// listItems holds the movie IDs of every list in position order.
+	listItems map[int64][]listItem
+
+	idempotencyKeys map[idempotencyKey]storage.IdempotencyRecord
+}
+
+func NewStorage() *Storage {
+	return &Storage{
+		movies:          make(map[int64]storage.Movie),
+		revisions:       make(map[int64][]storage.Revision),
+		externalIDs:     make(map[string]int64),
+		deleted:         make(map[int64]storage.DeletedMovie),
+		people:          make(map[int64]storage.Person),
+		credits:         make(map[int64]storage.Credit),
+		ratings:         make(map[ratingKey]storage.Rating),
+		reviews:         make(map[int64]storage.Review),
+		lists:           make(map[int64]storage.List),
+		listItems:       make(map[int64][]listItem),
+		idempotencyKeys: make(map[idempotencyKey]storage.IdempotencyRecord),
+	}
+}
@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+)
+
+func (s *Storage) GetDeletedMovies(
+	ctx context.Context,
+	filters storage.Filters,
+) (
+	[]*storage.DeletedMovie,
+	storage.Metadata,
+	error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.Metadata{}, err
+	}
+
+	s.mu.RLock()
+	deleted := make([]storage.DeletedMovie, 0, len(s.deleted))
+	for _, movie := range s.deleted {
+		movie.Movie = copyMovie(movie.Movie)
+		deleted = append(deleted, movie)
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(deleted, func(a, b storage.DeletedMovie) int {
+		if c := b.DeletedAt.Compare(a.DeletedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	start := min(filters.Offset(), len(deleted))
+	end := min(start+filters.PageSize, len(deleted))
+	movies := []*storage.DeletedMovie{}
+	for i := start; i < end; i++ {
+		movies = append(movies, &deleted[i])
+	}
+
+	totalRecords := len(deleted)
+	if len(movies) == 0 {
+		totalRecords = 0
+	}
+	return movies, storage.NewMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (s *Storage) RestoreMovie(ctx context.Context, id int64) (*storage.Movie, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted, ok := s.deleted[id]
+	if !ok {
+		return nil, storage.ErrRecordNotFound
+	}
+	delete(s.deleted, id)
+	s.movies[id] = deleted.Movie
+
+	movie := copyMovie(deleted.Movie)
+	return &movie, nil
+}
+
+func (s *Storage) PurgeMovie(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deleted[id]; !ok {
+		return storage.ErrRecordNotFound
+	}
+	s.purgeMovie(id)
+
+	return nil
+}
+
+func (s *Storage) PurgeDeletedMovies(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, movie := range s.deleted {
+		if movie.DeletedAt.Before(before) {
+			s.purgeMovie(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// purgeMovie must be called with s.mu held.
+func (s *Storage) purgeMovie(id int64) {
+	delete(s.deleted, id)
+	delete(s.revisions, id)
+	for externalID, movieID := range s.externalIDs {
+		if movieID == id {
+			delete(s.externalIDs, externalID)
+		}
+	}
+	for key := range s.ratings {
+		if key.movieID == id {
+			delete(s.ratings, key)
+		}
+	}
+	for reviewID, review := range s.reviews {
+		if review.MovieID == id {
+			delete(s.reviews, reviewID)
+		}
+	}
+	for listID, items := range s.listItems {
+		s.listItems[listID] = slices.DeleteFunc(items, func(item listItem) bool {
+			return item.movieID == id
+		})
+	}
+	for creditID, credit := range s.credits {
+		if credit.MovieID == id {
+			delete(s.credits, creditID)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrDuplicateCredit = errors.New("duplicate credit")
+
+type Person struct {
+	ID        int64     `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"-"`
+	Name      string    `db:"name" json:"name" validate:"required,lt=500"`
+	Version   int32     `db:"version" json:"version"`
+}
+
+// Credit links a person to a movie in a role. PersonName is filled in when
+// listing the credits of a movie, MovieTitle and MovieYear when listing the
+// filmography of a person.
+type Credit struct {
+	ID           int64  `json:"id"`
+	MovieID      int64  `json:"movie_id"`
+	PersonID     int64  `json:"person_id"`
+	Role         string `json:"role" validate:"required,oneof=actor director writer producer composer cinematographer editor"`
+	Character    string `json:"character,omitempty" validate:"lt=500"`
+	BillingOrder int32  `json:"billing_order" validate:"gte=0"`
+
+	PersonName string `json:"person_name,omitempty"`
+	MovieTitle string `json:"movie_title,omitempty"`
+	MovieYear  int32  `json:"movie_year,omitempty"`
+}
@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// BatchMovies applies the operations in order. An atomic batch is sent as a
+// single pgx.Batch inside one transaction and rolled back as a whole if any
+// operation fails; otherwise every operation stands on its own.
+func (s Storage) BatchMovies(
+	ctx context.Context,
+	ops []storage.BatchOperation,
+	atomic bool,
+) ([]storage.BatchResult, error) {
+	if !atomic {
+		return s.batchMoviesEach(ctx, ops)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin batch transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, op := range ops {
+		switch op.Op {
+		case storage.BatchCreate:
+			batch.Queue(createMovieQuery, movieArgs(ctx, op.Movie))
+		case storage.BatchUpdate:
+			batch.Queue(updateMovieQuery, movieArgs(ctx, op.Movie))
+		case storage.BatchDelete:
+			batch.Queue(deleteMovieQuery, pgx.NamedArgs{"id": op.ID, "version": op.Version})
+		default:
+			panic("unknown batch operation: " + op.Op)
+		}
+	}
+
+	results := make([]storage.BatchResult, len(ops))
+	failed := false
+	br := tx.SendBatch(ctx, batch)
+	for i, op := range ops {
+		switch op.Op {
+		case storage.BatchCreate:
+			movie := *op.Movie
+			err = br.QueryRow().Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+			results[i].Movie = &movie
+		case storage.BatchUpdate:
+			movie := *op.Movie
+			err = br.QueryRow().Scan(&movie.CreatedAt, &movie.Version, &movie.AverageRating, &movie.RatingsCount)
+			if errors.Is(err, sql.ErrNoRows) {
+				err = storage.ErrEditConflict
+			}
+			results[i].Movie = &movie
+		case storage.BatchDelete:
+			var tag pgconn.CommandTag
+			tag, err = br.Exec()
+			if err == nil && tag.RowsAffected() == 0 {
+				err = storage.ErrRecordNotFound
+			}
+		}
+
+		if err != nil {
+			if !errors.Is(err, storage.ErrEditConflict) && !errors.Is(err, storage.ErrRecordNotFound) {
+				br.Close()
+				return nil, fmt.Errorf("failed to execute batch operation %d: %w", i, err)
+			}
+			results[i] = storage.BatchResult{Err: err}
+			failed = true
+		}
+	}
+	if err := br.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close batch: %w", err)
+	}
+
+	if failed {
+		for i, op := range ops {
+			if op.Op == storage.BatchDelete && errors.Is(results[i].Err, storage.ErrRecordNotFound) && op.Version != 0 {
+				results[i].Err = missingMovieError(ctx, tx, op.ID)
+			}
+		}
+		storage.AbortBatch(results)
+		return results, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit batch: %w", err)
+	}
+
+	return results, nil
+}
+
+func (s Storage) batchMoviesEach(ctx context.Context, ops []storage.BatchOperation) ([]storage.BatchResult, error) {
+	results := make([]storage.BatchResult, len(ops))
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case storage.BatchCreate:
+			movie := *op.Movie
+			err = s.CreateMovie(ctx, &movie)
+			results[i].Movie = &movie
+		case storage.BatchUpdate:
+			movie := *op.Movie
+			err = s.UpdateMovie(ctx, &movie)
+			results[i].Movie = &movie
+		case storage.BatchDelete:
+			err = s.DeleteMovie(ctx, op.ID, op.Version)
+		default:
+			panic("unknown batch operation: " + op.Op)
+		}
+
+		if err != nil {
+			if !errors.Is(err, storage.ErrEditConflict) && !errors.Is(err, storage.ErrRecordNotFound) {
+				return nil, fmt.Errorf("failed to execute batch operation %d: %w", i, err)
+			}
+			results[i] = storage.BatchResult{Err: err}
+		}
+	}
+
+	return results, nil
+}
+
+func movieArgs(ctx context.Context, movie *storage.Movie) pgx.NamedArgs {
+	return pgx.NamedArgs{
+		"user_id": storage.ActingUserID(ctx),
+		"id":      movie.ID,
+		"title":   movie.Title,
+		"year":    movie.Year,
+		"runtime": movie.Runtime,
+		"genres":  movie.Genres,
+		"version": movie.Version,
+	}
+}
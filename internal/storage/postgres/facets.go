@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s Storage) GetMovieFacets(
+	ctx context.Context,
+	title string,
+	genres []string,
+	filters storage.Filters,
+	facets []string,
+) (storage.Facets, error) {
+	args := movieFilterArgs(title, genres, filters)
+	args["runtime_buckets"] = storage.RuntimeBuckets()
+	condition := movieFilterCondition(filters.Fuzzy)
+
+	queries := map[string]string{
+		"genres": `
+			SELECT genre, count(*)
+			FROM movies, unnest(genres) AS genre
+			WHERE ` + condition + `
+			GROUP BY genre
+			ORDER BY count(*) DESC, genre ASC`,
+		"year": `
+			SELECT year / 10 * 10, count(*)
+			FROM movies
+			WHERE ` + condition + `
+			GROUP BY 1
+			ORDER BY 1`,
+		"runtime": `
+			SELECT width_bucket(runtime, @runtime_buckets::integer[]), count(*)
+			FROM movies
+			WHERE ` + condition + `
+			GROUP BY 1
+			ORDER BY 1`,
+	}
+
+	batch := &pgx.Batch{}
+	for _, facet := range facets {
+		query, ok := queries[facet]
+		if !ok {
+			panic("unknown facet: " + facet)
+		}
+		batch.Queue(query, args)
+	}
+
+	results := s.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	var result storage.Facets
+	for _, facet := range facets {
+		rows, err := results.Query()
+		if err != nil {
+			return storage.Facets{}, fmt.Errorf("failed to query %s facet: %w", facet, err)
+		}
+
+		switch facet {
+		case "genres":
+			result.Genres, err = pgx.CollectRows(rows, pgx.RowToStructByPos[storage.FacetCount])
+		case "year":
+			result.Year, err = collectFacet(rows, storage.DecadeLabel)
+		case "runtime":
+			result.Runtime, err = collectFacet(rows, func(bucket int32) string {
+				return storage.RuntimeBucketLabel(int(bucket))
+			})
+		}
+		if err != nil {
+			return storage.Facets{}, fmt.Errorf("failed to collect %s facet: %w", facet, err)
+		}
+	}
+
+	return result, nil
+}
+
+func collectFacet(rows pgx.Rows, label func(int32) string) ([]storage.FacetCount, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (storage.FacetCount, error) {
+		var key int32
+		var count int
+		if err := row.Scan(&key, &count); err != nil {
+			return storage.FacetCount{}, err
+		}
+		return storage.FacetCount{Value: label(key), Count: count}, nil
+	})
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateIdempotencyKey reserves the key for a new request. A key that has
+// expired but has not been swept yet is taken over.
+func (s Storage) CreateIdempotencyKey(ctx context.Context, record *storage.IdempotencyRecord) error {
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint, expires_at)
+		VALUES (@user_id, @key, @fingerprint, @expires_at)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint,
+			status = 0,
+			header = '{}',
+			body = NULL,
+			created_at = NOW(),
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING created_at`
+
+	args := pgx.NamedArgs{
+		"user_id":     record.UserID,
+		"key":         record.Key,
+		"fingerprint": record.Fingerprint,
+		"expires_at":  record.ExpiresAt,
+	}
+
+	err := s.db.QueryRow(ctx, query, args).Scan(&record.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrDuplicateIdempotencyKey
+		}
+		return fmt.Errorf("failed to query create idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (s Storage) GetIdempotencyKey(ctx context.Context, userID int64, key string) (*storage.IdempotencyRecord, error) {
+	query := `
+		SELECT user_id, key, fingerprint, status, header, body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND expires_at > NOW()`
+
+	var record storage.IdempotencyRecord
+	err := s.db.QueryRow(ctx, query, userID, key).Scan(
+		&record.UserID,
+		&record.Key,
+		&record.Fingerprint,
+		&record.Status,
+		&record.Header,
+		&record.Body,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (s Storage) CompleteIdempotencyKey(ctx context.Context, record *storage.IdempotencyRecord) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status = @status, header = @header, body = @body
+		WHERE user_id = @user_id AND key = @key`
+
+	args := pgx.NamedArgs{
+		"user_id": record.UserID,
+		"key":     record.Key,
+		"status":  record.Status,
+		"header":  record.Header,
+		"body":    record.Body,
+	}
+
+	result, err := s.db.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("failed to query complete idempotency key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return storage.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (s Storage) DeleteIdempotencyKey(ctx context.Context, userID int64, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2`
+
+	_, err := s.db.Exec(ctx, query, userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to query delete idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (s Storage) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE expires_at <= NOW()`
+
+	result, err := s.db.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query delete expired idempotency keys: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// ImportMovies loads the records with COPY into a temporary table and
+// upserts them by external_id in one transaction. Rows whose data did not
+// change keep their version; movies in the trash are skipped, so an import
+// never rewrites a movie nobody can see.
+func (s Storage) ImportMovies(ctx context.Context, records []storage.ImportRecord) (storage.ImportStats, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return storage.ImportStats{}, fmt.Errorf("failed to begin import transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE movies_import (
+			external_id text NOT NULL,
+			title text NOT NULL,
+			year integer NOT NULL,
+			runtime integer NOT NULL,
+			genres text[] NOT NULL
+		) ON COMMIT DROP`)
+	if err != nil {
+		return storage.ImportStats{}, fmt.Errorf("failed to create import table: %w", err)
+	}
+
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"movies_import"},
+		[]string{"external_id", "title", "year", "runtime", "genres"},
+		pgx.CopyFromSlice(len(records), func(i int) ([]any, error) {
+			r := records[i]
+			return []any{r.ExternalID, r.Movie.Title, r.Movie.Year, int32(r.Movie.Runtime), r.Movie.Genres}, nil
+		}),
+	)
+	if err != nil {
+		return storage.ImportStats{}, fmt.Errorf("failed to copy movies: %w", err)
+	}
+
+	var stats storage.ImportStats
+	err = tx.QueryRow(ctx, `
+		SELECT count(*)
+		FROM movies_import
+		JOIN movies USING (external_id)
+		WHERE movies.deleted_at IS NOT NULL`).Scan(&stats.Skipped)
+	if err != nil {
+		return storage.ImportStats{}, fmt.Errorf("failed to count trashed movies: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		WITH movie AS (
+			INSERT INTO movies (external_id, title, year, runtime, genres)
+			SELECT external_id, title, year, runtime, genres
+			FROM movies_import
+			ON CONFLICT (external_id) DO UPDATE
+			SET title = EXCLUDED.title,
+				year = EXCLUDED.year,
+				runtime = EXCLUDED.runtime,
+				genres = EXCLUDED.genres,
+				version = movies.version + 1
+			WHERE movies.deleted_at IS NULL
+				AND (movies.title, movies.year, movies.runtime, movies.genres)
+				IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.year, EXCLUDED.runtime, EXCLUDED.genres)
+			RETURNING id, title, year, runtime, genres, version, xmax = 0 AS inserted
+		), revision AS (
+			INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres, user_id)
+			SELECT id, version, title, year, runtime, genres, @user_id
+			FROM movie
+		)
+		SELECT inserted FROM movie`, pgx.NamedArgs{"user_id": storage.ActingUserID(ctx)})
+	if err != nil {
+		return storage.ImportStats{}, fmt.Errorf("failed to query upsert movies: %w", err)
+	}
+	inserted, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+	if err != nil {
+		return storage.ImportStats{}, fmt.Errorf("failed to upsert movies: %w", err)
+	}
+
+	for _, isInsert := range inserted {
+		if isInsert {
+			stats.Inserted++
+		} else {
+			stats.Updated++
+		}
+	}
+	stats.Unchanged = len(records) - len(inserted) - stats.Skipped
+
+	if err := tx.Commit(ctx); err != nil {
+		return storage.ImportStats{}, fmt.Errorf("failed to commit import: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,359 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func (s Storage) CreateList(ctx context.Context, list *storage.List) error {
+	query := `
+		INSERT INTO lists (user_id, kind, name, public)
+		VALUES (@user_id, @kind, @name, @public)
+		RETURNING id, created_at, version`
+
+	args := pgx.NamedArgs{
+		"user_id": list.UserID,
+		"kind":    list.Kind,
+		"name":    list.Name,
+		"public":  list.Public,
+	}
+
+	err := s.db.QueryRow(ctx, query, args).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return storage.ErrDuplicateList
+		}
+		return fmt.Errorf("failed to query create list: %w", err)
+	}
+
+	return nil
+}
+
+func (s Storage) GetList(ctx context.Context, id int64) (*storage.List, error) {
+	if id < 1 {
+		return nil, storage.ErrRecordNotFound
+	}
+	query := `
+		SELECT id, user_id, kind, name, public, created_at, version
+		FROM lists
+		WHERE id = $1`
+
+	rows, err := s.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query get list: %w", err)
+	}
+	list, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[storage.List])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get list: %w", err)
+	}
+
+	return &list, nil
+}
+
+// GetUserLists returns the lists of a user, watchlist and favorites first.
+func (s Storage) GetUserLists(ctx context.Context, userID int64, publicOnly bool) ([]*storage.List, error) {
+	query := `
+		SELECT id, user_id, kind, name, public, created_at, version
+		FROM lists
+		WHERE user_id = @user_id AND (public OR NOT @public_only)
+		ORDER BY kind = 'custom', kind, id`
+
+	args := pgx.NamedArgs{
+		"user_id":     userID,
+		"public_only": publicOnly,
+	}
+
+	rows, err := s.db.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query get user lists: %w", err)
+	}
+	lists, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[storage.List])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user lists: %w", err)
+	}
+
+	return lists, nil
+}
+
+func (s Storage) UpdateList(ctx context.Context, list *storage.List) error {
+	query := `
+		UPDATE lists
+		SET name = @name, public = @public, version = version + 1
+		WHERE id = @id AND version = @version
+		RETURNING version`
+
+	args := pgx.NamedArgs{
+		"id":      list.ID,
+		"name":    list.Name,
+		"public":  list.Public,
+		"version": list.Version,
+	}
+
+	err := s.db.QueryRow(ctx, query, args).Scan(&list.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrEditConflict
+		}
+		return fmt.Errorf("failed to query update list: %w", err)
+	}
+
+	return nil
+}
+
+func (s Storage) DeleteList(ctx context.Context, id int64) error {
+	result, err := s.db.Exec(ctx, "DELETE FROM lists WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to query delete list: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return storage.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetListItems returns a page of the list in position order. Movies in the
+// trash are left out.
+func (s Storage) GetListItems(
+	ctx context.Context,
+	listID int64,
+	filters storage.Filters,
+) (
+	[]*storage.ListItem,
+	storage.Metadata,
+	error,
+) {
+	query := `
+		SELECT count(*) OVER(), i.position, i.added_at,
+			m.id, m.created_at, m.title, m.year, m.runtime, m.genres, m.version,
+			m.average_rating, m.ratings_count
+		FROM list_items i
+		JOIN movies m ON m.id = i.movie_id
+		WHERE i.list_id = @list_id AND m.deleted_at IS NULL
+		ORDER BY i.position ASC
+		LIMIT @limit OFFSET @offset`
+
+	args := pgx.NamedArgs{
+		"list_id": listID,
+		"limit":   filters.PageSize,
+		"offset":  filters.Offset(),
+	}
+
+	rows, err := s.db.Query(ctx, query, args)
+	if err != nil {
+		return nil, storage.Metadata{}, fmt.Errorf("failed to query get list items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []*storage.ListItem{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var item storage.ListItem
+		err := rows.Scan(
+			&totalRecords,
+			&item.Position,
+			&item.AddedAt,
+			&item.Movie.ID,
+			&item.Movie.CreatedAt,
+			&item.Movie.Title,
+			&item.Movie.Year,
+			&item.Movie.Runtime,
+			&item.Movie.Genres,
+			&item.Movie.Version,
+			&item.Movie.AverageRating,
+			&item.Movie.RatingsCount,
+		)
+		if err != nil {
+			return nil, storage.Metadata{}, fmt.Errorf("failed to scan list item: %w", err)
+		}
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, storage.Metadata{}, fmt.Errorf("failed to get list items: %w", err)
+	}
+
+	return items, storage.NewMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// AddListItem inserts the movie at position, shifting later items down. A
+// zero or out of range position appends the movie.
+func (s Storage) AddListItem(ctx context.Context, listID, movieID int64, position int32) (*storage.ListItem, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin list transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	count, err := lockList(ctx, tx, listID)
+	if err != nil {
+		return nil, err
+	}
+	if position < 1 || position > count+1 {
+		position = count + 1
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE list_items SET position = position + 1
+		WHERE list_id = $1 AND position >= $2`, listID, position)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shift list items: %w", err)
+	}
+
+	query := `
+		INSERT INTO list_items (list_id, movie_id, position)
+		SELECT @list_id, id, @position
+		FROM movies
+		WHERE id = @movie_id AND deleted_at IS NULL
+		RETURNING added_at`
+
+	args := pgx.NamedArgs{
+		"list_id":  listID,
+		"movie_id": movieID,
+		"position": position,
+	}
+
+	item := &storage.ListItem{Position: position}
+	err = tx.QueryRow(ctx, query, args).Scan(&item.AddedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, storage.ErrRecordNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+			return nil, storage.ErrDuplicateListItem
+		default:
+			return nil, fmt.Errorf("failed to query add list item: %w", err)
+		}
+	}
+
+	movie, err := getMovie(ctx, tx, movieID)
+	if err != nil {
+		return nil, err
+	}
+	item.Movie = *movie
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit list item: %w", err)
+	}
+
+	return item, nil
+}
+
+// MoveListItem moves the movie to position, shifting the items in between.
+func (s Storage) MoveListItem(ctx context.Context, listID, movieID int64, position int32) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin list transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	count, err := lockList(ctx, tx, listID)
+	if err != nil {
+		return err
+	}
+	position = max(1, min(position, count))
+
+	var current int32
+	err = tx.QueryRow(ctx, "SELECT position FROM list_items WHERE list_id = $1 AND movie_id = $2", listID, movieID).
+		Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrRecordNotFound
+		}
+		return fmt.Errorf("failed to query list item position: %w", err)
+	}
+
+	query := `
+		UPDATE list_items
+		SET position = CASE
+			WHEN movie_id = @movie_id THEN @position
+			WHEN @position < @current THEN position + 1
+			ELSE position - 1
+		END
+		WHERE list_id = @list_id
+			AND position BETWEEN least(@position, @current) AND greatest(@position, @current)`
+
+	args := pgx.NamedArgs{
+		"list_id":  listID,
+		"movie_id": movieID,
+		"position": position,
+		"current":  current,
+	}
+
+	if _, err := tx.Exec(ctx, query, args); err != nil {
+		return fmt.Errorf("failed to query move list item: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit list item: %w", err)
+	}
+
+	return nil
+}
+
+func (s Storage) RemoveListItem(ctx context.Context, listID, movieID int64) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin list transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockList(ctx, tx, listID); err != nil {
+		return err
+	}
+
+	var position int32
+	err = tx.QueryRow(ctx, "DELETE FROM list_items WHERE list_id = $1 AND movie_id = $2 RETURNING position", listID, movieID).
+		Scan(&position)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrRecordNotFound
+		}
+		return fmt.Errorf("failed to query remove list item: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE list_items SET position = position - 1
+		WHERE list_id = $1 AND position > $2`, listID, position)
+	if err != nil {
+		return fmt.Errorf("failed to query shift list items: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit list item: %w", err)
+	}
+
+	return nil
+}
+
+// lockList locks the list so that concurrent changes keep positions
+// contiguous, and returns the number of items in it.
+func lockList(ctx context.Context, tx pgx.Tx, listID int64) (int32, error) {
+	var id int64
+	err := tx.QueryRow(ctx, "SELECT id FROM lists WHERE id = $1 FOR UPDATE", listID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, storage.ErrRecordNotFound
+		}
+		return 0, fmt.Errorf("failed to query lock list: %w", err)
+	}
+
+	var count int32
+	err = tx.QueryRow(ctx, "SELECT count(*) FROM list_items WHERE list_id = $1", listID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query count list items: %w", err)
+	}
+
+	return count, nil
+}
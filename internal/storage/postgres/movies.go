@@ -5,29 +5,47 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/AndreyChufelin/movies-api/internal/storage"
 	"github.com/jackc/pgx/v5"
 )
 
-func (s Storage) CreateMovie(movie *storage.Movie) error {
-	query := `
-		INSERT INTO movies (title, year, runtime, genres)
-		VALUES (@title, @year, @runtime, @genres)
-		RETURNING id, created_at, version`
-	args := pgx.NamedArgs{
-		"title":   movie.Title,
-		"year":    movie.Year,
-		"runtime": movie.Runtime,
-		"genres":  movie.Genres,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// createMovieQuery and updateMovieQuery record the new version of the movie
+// in movie_revisions in the same statement as the write.
+const (
+	createMovieQuery = `
+		WITH movie AS (
+			INSERT INTO movies (title, year, runtime, genres)
+			VALUES (@title, @year, @runtime, @genres)
+			RETURNING id, created_at, title, year, runtime, genres, version
+		), revision AS (
+			INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres, user_id, created_at)
+			SELECT id, version, title, year, runtime, genres, @user_id, created_at
+			FROM movie
+		)
+		SELECT id, created_at, version FROM movie`
+	updateMovieQuery = `
+		WITH movie AS (
+			UPDATE movies
+			SET title = @title, year = @year, runtime = @runtime, genres = @genres, version = version + 1
+			WHERE id = @id AND version = @version AND deleted_at IS NULL
+			RETURNING id, created_at, title, year, runtime, genres, version, average_rating, ratings_count
+		), revision AS (
+			INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres, user_id)
+			SELECT id, version, title, year, runtime, genres, @user_id
+			FROM movie
+		)
+		SELECT created_at, version, average_rating, ratings_count FROM movie`
+	deleteMovieQuery = `
+		UPDATE movies
+		SET deleted_at = NOW()
+		WHERE id = @id AND deleted_at IS NULL AND (@version::integer = 0 OR version = @version)`
+)
 
-	err := s.db.QueryRow(ctx, query, args).
+func (s Storage) CreateMovie(ctx context.Context, movie *storage.Movie) error {
+	err := s.db.QueryRow(ctx, createMovieQuery, movieArgs(ctx, movie)).
 		Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
 	if err != nil {
 		return fmt.Errorf("failed to query create movie: %w", err)
@@ -36,19 +54,20 @@ func (s Storage) CreateMovie(movie *storage.Movie) error {
 	return nil
 }
 
-func (s Storage) GetMovie(id int64) (*storage.Movie, error) {
+func (s Storage) GetMovie(ctx context.Context, id int64) (*storage.Movie, error) {
+	return getMovie(ctx, s.db, id)
+}
+
+func getMovie(ctx context.Context, q querier, id int64) (*storage.Movie, error) {
 	if id < 1 {
 		return nil, storage.ErrRecordNotFound
 	}
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, created_at, title, year, runtime, genres, version, average_rating, ratings_count
 		FROM movies
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	rows, err := s.db.Query(ctx, query, id)
+	rows, err := q.Query(ctx, query, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query get movie: %w", err)
 	}
@@ -64,6 +83,7 @@ func (s Storage) GetMovie(id int64) (*storage.Movie, error) {
 }
 
 func (s Storage) GetAllMovies(
+	ctx context.Context,
 	title string,
 	genres []string,
 	filters storage.Filters,
@@ -72,27 +92,63 @@ func (s Storage) GetAllMovies(
 	storage.Metadata,
 	error,
 ) {
-	query := fmt.Sprintf(`
-		SELECT  count(*) OVER(), id, created_at, title, year, runtime, genres, version
-		FROM movies
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', @title) OR @title = '')
-		AND (genres @> @genres OR @genres = '{""}')
-		ORDER BY %s %s, id ASC
-		LIMIT @limit OFFSET @offset`, sortColumn(filters), sortDirection(filters))
+	movies, totalRecords, err := s.queryMovies(ctx, title, genres, filters)
+	if err != nil {
+		return nil, storage.Metadata{}, err
+	}
 
-	args := pgx.NamedArgs{
-		"title":  title,
-		"genres": genres,
-		"limit":  filters.PageSize,
-		"offset": filters.Offset(),
+	// Nothing matched the full-text query, which is often a typo: retry the
+	// first page with trigram similarity. Later pages keep the mode through
+	// the cursor or the fuzzy parameter.
+	if len(movies) == 0 && title != "" && !filters.Fuzzy && filters.Cursor == nil && filters.Page == 1 {
+		filters.Fuzzy = true
+		movies, totalRecords, err = s.queryMovies(ctx, title, genres, filters)
+		if err != nil {
+			return nil, storage.Metadata{}, err
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	movies, metadata := storage.NewPage(movies, totalRecords, filters)
+	return movies, metadata, nil
+}
+
+func (s Storage) queryMovies(
+	ctx context.Context,
+	title string,
+	genres []string,
+	filters storage.Filters,
+) ([]*storage.Movie, int, error) {
+	args := movieFilterArgs(title, genres, filters)
+	args["limit"] = filters.PageSize + 1
+	args["offset"] = filters.Offset()
+
+	keyset, err := keysetCondition(title, filters, args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := "0"
+	if filters.IncludeTotal && filters.Cursor == nil {
+		total = "count(*) OVER()"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, id, created_at, title, year, runtime, genres, version, average_rating, ratings_count, %s, %s
+		FROM movies
+		WHERE %s %s
+		ORDER BY %s
+		LIMIT @limit OFFSET @offset`,
+		total,
+		rankExpression(title, filters.Fuzzy),
+		highlightExpression(title, filters.Fuzzy),
+		movieFilterCondition(filters.Fuzzy),
+		keyset,
+		orderBy(title, filters),
+	)
 
 	rows, err := s.db.Query(ctx, query, args)
 	if err != nil {
-		return nil, storage.Metadata{}, fmt.Errorf("failed to query get all movies: %w", err)
+		return nil, 0, fmt.Errorf("failed to query get all movies: %w", err)
 	}
 	defer rows.Close()
 
@@ -110,41 +166,123 @@ func (s Storage) GetAllMovies(
 			&movie.Runtime,
 			&movie.Genres,
 			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingsCount,
+			&movie.Rank,
+			&movie.Highlight,
 		)
 		if err != nil {
-			return nil, storage.Metadata{}, fmt.Errorf("failed to scan all movies: %w", err)
+			return nil, 0, fmt.Errorf("failed to scan all movies: %w", err)
 		}
 		movies = append(movies, &movie)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, storage.Metadata{}, fmt.Errorf("failed to get all movies: %w", err)
+		return nil, 0, fmt.Errorf("failed to get all movies: %w", err)
 	}
 
-	metadata := storage.NewMetadata(totalRecords, filters.Page, filters.PageSize)
-	return movies, metadata, nil
+	if filters.IncludeTotal && filters.Cursor != nil {
+		totalRecords, err = s.countMovies(ctx, title, genres, filters)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return movies, totalRecords, nil
 }
 
-func (s Storage) UpdateMovie(movie *storage.Movie) error {
+func (s Storage) countMovies(ctx context.Context, title string, genres []string, filters storage.Filters) (int, error) {
 	query := `
-		UPDATE movies
-		SET title = @title, year = @year, runtime = @runtime, genres = @genres, version = version + 1
-		WHERE id = @id AND version = @version
-		RETURNING version`
+		SELECT count(*)
+		FROM movies
+		WHERE ` + movieFilterCondition(filters.Fuzzy)
+
+	var count int
+	err := s.db.QueryRow(ctx, query, movieFilterArgs(title, genres, filters)).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query count movies: %w", err)
+	}
+
+	return count, nil
+}
+
+// ExportMovies streams every movie matching the filters to fn in id order.
+// Rows are handed over as pgx reads them off the connection, so memory use
+// does not grow with the catalog.
+func (s Storage) ExportMovies(
+	ctx context.Context,
+	title string,
+	genres []string,
+	filters storage.Filters,
+	fn func(*storage.Movie) error,
+) error {
+	query := `
+		SELECT id, created_at, title, year, runtime, genres, version, average_rating, ratings_count
+		FROM movies
+		WHERE ` + movieFilterCondition(filters.Fuzzy) + `
+		ORDER BY id ASC`
+
+	rows, err := s.db.Query(ctx, query, movieFilterArgs(title, genres, filters))
+	if err != nil {
+		return fmt.Errorf("failed to query export movies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie storage.Movie
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			&movie.Genres,
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingsCount,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan exported movie: %w", err)
+		}
+		if err := fn(&movie); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export movies: %w", err)
+	}
+
+	return nil
+}
+
+func (s Storage) SuggestMovies(ctx context.Context, query string, limit int) ([]storage.Suggestion, error) {
+	sqlQuery := `
+		SELECT id, title
+		FROM movies
+		WHERE deleted_at IS NULL AND (lower(title) LIKE @prefix OR title % @query)
+		ORDER BY lower(title) LIKE @prefix DESC, similarity(title, @query) DESC, title ASC
+		LIMIT @limit`
 
 	args := pgx.NamedArgs{
-		"id":      movie.ID,
-		"title":   movie.Title,
-		"year":    movie.Year,
-		"runtime": movie.Runtime,
-		"genres":  movie.Genres,
-		"version": movie.Version,
+		"query":  query,
+		"prefix": escapeLike(strings.ToLower(query)) + "%",
+		"limit":  limit,
+	}
+
+	rows, err := s.db.Query(ctx, sqlQuery, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query suggest movies: %w", err)
+	}
+	suggestions, err := pgx.CollectRows(rows, pgx.RowToStructByPos[storage.Suggestion])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect suggestions: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	return suggestions, nil
+}
 
-	err := s.db.QueryRow(ctx, query, args).
-		Scan(&movie.Version)
+func (s Storage) UpdateMovie(ctx context.Context, movie *storage.Movie) error {
+	err := s.db.QueryRow(ctx, updateMovieQuery, movieArgs(ctx, movie)).
+		Scan(&movie.CreatedAt, &movie.Version, &movie.AverageRating, &movie.RatingsCount)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return storage.ErrEditConflict
@@ -155,31 +293,212 @@ func (s Storage) UpdateMovie(movie *storage.Movie) error {
 	return nil
 }
 
-func (s Storage) DeleteMovie(id int64) error {
+// DeleteMovie moves the movie to the trash. A non-zero version makes the
+// delete conditional on the movie still being at that version.
+func (s Storage) DeleteMovie(ctx context.Context, id int64, version int32) error {
 	if id < 1 {
 		return storage.ErrRecordNotFound
 	}
 
-	query := `
-		DELETE FROM movies
-		WHERE id = $1`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	args := pgx.NamedArgs{
+		"id":      id,
+		"version": version,
+	}
 
-	result, err := s.db.Exec(ctx, query, id)
+	result, err := s.db.Exec(ctx, deleteMovieQuery, args)
 	if err != nil {
 		return err
 	}
 
 	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return storage.ErrRecordNotFound
+		if version == 0 {
+			return storage.ErrRecordNotFound
+		}
+		return missingMovieError(ctx, s.db, id)
 	}
 
 	return nil
 }
 
+// missingMovieError tells apart a movie that is gone from one that changed
+// under a versioned write.
+func missingMovieError(ctx context.Context, q querier, id int64) error {
+	var exists bool
+	err := q.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM movies WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to query movie exists: %w", err)
+	}
+	if exists {
+		return storage.ErrEditConflict
+	}
+	return storage.ErrRecordNotFound
+}
+
+const (
+	titleSearchCondition = `(to_tsvector('simple', title) @@ websearch_to_tsquery('simple', @title) OR @title = '')`
+	titleFuzzyCondition  = `(title % @title OR @title = '')`
+)
+
+func movieFilterCondition(fuzzy bool) string {
+	titleCondition := titleSearchCondition
+	if fuzzy {
+		titleCondition = titleFuzzyCondition
+	}
+
+	return `deleted_at IS NULL
+		AND ` + titleCondition + `
+		AND (
+			cardinality(@genres::text[]) = 0
+			OR (@genres_match = 'all' AND genres @> @genres::text[])
+			OR (@genres_match = 'any' AND genres && @genres::text[])
+		)
+		AND NOT genres && @excluded_genres::text[]
+		AND (@year_from::integer = 0 OR year >= @year_from)
+		AND (@year_to::integer = 0 OR year <= @year_to)
+		AND (@runtime_min::integer = 0 OR runtime >= @runtime_min)
+		AND (@runtime_max::integer = 0 OR runtime <= @runtime_max)
+		AND (@min_rating::numeric = 0 OR average_rating >= @min_rating)
+		AND (@person_id::bigint = 0 OR EXISTS (
+			SELECT 1 FROM movie_credits
+			WHERE movie_credits.movie_id = movies.id AND movie_credits.person_id = @person_id
+		))`
+}
+
+func rankExpression(title string, fuzzy bool) string {
+	switch {
+	case title == "":
+		return "0::real"
+	case fuzzy:
+		return "similarity(title, @title)"
+	default:
+		return "ts_rank(to_tsvector('simple', title), websearch_to_tsquery('simple', @title))"
+	}
+}
+
+func highlightExpression(title string, fuzzy bool) string {
+	if title == "" || fuzzy {
+		return "''"
+	}
+	return "ts_headline('simple', title, websearch_to_tsquery('simple', @title))"
+}
+
+func sortExpression(title string, filters storage.Filters) string {
+	switch column := sortColumn(filters); column {
+	case "relevance":
+		return rankExpression(title, filters.Fuzzy)
+	case "rating":
+		return "average_rating"
+	default:
+		return column
+	}
+}
+
+func movieFilterArgs(title string, genres []string, filters storage.Filters) pgx.NamedArgs {
+	if genres == nil {
+		genres = []string{}
+	}
+	excludedGenres := filters.ExcludedGenres
+	if excludedGenres == nil {
+		excludedGenres = []string{}
+	}
+
+	return pgx.NamedArgs{
+		"title":           title,
+		"genres":          genres,
+		"genres_match":    filters.GenresMatch,
+		"excluded_genres": excludedGenres,
+		"year_from":       filters.YearFrom,
+		"year_to":         filters.YearTo,
+		"runtime_min":     filters.RuntimeMin,
+		"runtime_max":     filters.RuntimeMax,
+		"person_id":       filters.PersonID,
+		"min_rating":      filters.MinRating,
+	}
+}
+
+func orderBy(title string, filters storage.Filters) string {
+	direction, idDirection := sortDirection(filters), "ASC"
+	if filters.Cursor != nil && filters.Cursor.Backward {
+		direction, idDirection = reverseDirection(direction), reverseDirection(idDirection)
+	}
+
+	return fmt.Sprintf("%s %s, id %s", sortExpression(title, filters), direction, idDirection)
+}
+
+// keysetCondition restricts the query to rows after the cursor in the current
+// sort order, or before it when the client pages backward.
+func keysetCondition(title string, filters storage.Filters, args pgx.NamedArgs) (string, error) {
+	cursor := filters.Cursor
+	if cursor == nil {
+		return "", nil
+	}
+
+	value, err := cursorValue(sortColumn(filters), cursor.Value)
+	if err != nil {
+		return "", err
+	}
+	args["cursor_value"] = value
+	args["cursor_id"] = cursor.ID
+	args["offset"] = 0
+
+	op, idOp := ">", ">"
+	if sortDirection(filters) == "DESC" {
+		op = "<"
+	}
+	if cursor.Backward {
+		op, idOp = reverseOperator(op), reverseOperator(idOp)
+	}
+
+	return fmt.Sprintf(
+		"AND (%[1]s %[2]s @cursor_value OR (%[1]s = @cursor_value AND id %[3]s @cursor_id))",
+		sortExpression(title, filters), op, idOp,
+	), nil
+}
+
+func cursorValue(column, value string) (any, error) {
+	switch column {
+	case "title":
+		return value, nil
+	case "relevance":
+		v, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, storage.ErrInvalidCursor
+		}
+		return float32(v), nil
+	case "rating":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, storage.ErrInvalidCursor
+		}
+		return v, nil
+	default:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, storage.ErrInvalidCursor
+		}
+		return v, nil
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func reverseDirection(direction string) string {
+	if direction == "ASC" {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func reverseOperator(op string) string {
+	if op == ">" {
+		return "<"
+	}
+	return ">"
+}
+
 func sortColumn(filters storage.Filters) string {
 	for _, safeValue := range filters.SortSafelist {
 		if filters.Sort == safeValue {
@@ -190,7 +509,7 @@ func sortColumn(filters storage.Filters) string {
 }
 
 func sortDirection(filters storage.Filters) string {
-	if strings.HasPrefix(filters.Sort, "-") {
+	if strings.HasPrefix(filters.Sort, "-") || filters.Sort == "relevance" {
 		return "DESC"
 	}
 	return "ASC"
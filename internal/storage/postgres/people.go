@@ -0,0 +1,293 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const uniqueViolation = "23505"
+
+func (s Storage) CreatePerson(ctx context.Context, person *storage.Person) error {
+	query := `
+		INSERT INTO people (name)
+		VALUES ($1)
+		RETURNING id, created_at, version`
+
+	err := s.db.QueryRow(ctx, query, person.Name).
+		Scan(&person.ID, &person.CreatedAt, &person.Version)
+	if err != nil {
+		return fmt.Errorf("failed to query create person: %w", err)
+	}
+
+	return nil
+}
+
+func (s Storage) GetPerson(ctx context.Context, id int64) (*storage.Person, error) {
+	if id < 1 {
+		return nil, storage.ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, name, version
+		FROM people
+		WHERE id = $1`
+
+	rows, err := s.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query get person: %w", err)
+	}
+	person, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[storage.Person])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get person: %w", err)
+	}
+
+	return &person, nil
+}
+
+func (s Storage) GetAllPeople(
+	ctx context.Context,
+	name string,
+	filters storage.Filters,
+) (
+	[]*storage.Person,
+	storage.Metadata,
+	error,
+) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, version
+		FROM people
+		WHERE (name ILIKE @pattern OR @name = '')
+		ORDER BY %s %s, id ASC
+		LIMIT @limit OFFSET @offset`,
+		sortColumn(filters), sortDirection(filters),
+	)
+
+	args := pgx.NamedArgs{
+		"name":    name,
+		"pattern": "%" + escapeLike(name) + "%",
+		"limit":   filters.PageSize,
+		"offset":  filters.Offset(),
+	}
+
+	rows, err := s.db.Query(ctx, query, args)
+	if err != nil {
+		return nil, storage.Metadata{}, fmt.Errorf("failed to query get all people: %w", err)
+	}
+	defer rows.Close()
+
+	people := []*storage.Person{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var person storage.Person
+		err := rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, storage.Metadata{}, fmt.Errorf("failed to scan person: %w", err)
+		}
+		people = append(people, &person)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, storage.Metadata{}, fmt.Errorf("failed to get all people: %w", err)
+	}
+
+	return people, storage.NewMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (s Storage) UpdatePerson(ctx context.Context, person *storage.Person) error {
+	query := `
+		UPDATE people
+		SET name = @name, version = version + 1
+		WHERE id = @id AND version = @version
+		RETURNING version`
+
+	args := pgx.NamedArgs{
+		"id":      person.ID,
+		"name":    person.Name,
+		"version": person.Version,
+	}
+
+	err := s.db.QueryRow(ctx, query, args).Scan(&person.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrEditConflict
+		}
+		return fmt.Errorf("failed to query update person: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePerson removes the person and their credits. A non-zero version
+// makes the delete conditional on the person still being at that version.
+func (s Storage) DeletePerson(ctx context.Context, id int64, version int32) error {
+	if id < 1 {
+		return storage.ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM people
+		WHERE id = @id AND (@version::integer = 0 OR version = @version)`
+
+	args := pgx.NamedArgs{
+		"id":      id,
+		"version": version,
+	}
+
+	result, err := s.db.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("failed to query delete person: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		if version == 0 {
+			return storage.ErrRecordNotFound
+		}
+		var exists bool
+		err := s.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM people WHERE id = $1)", id).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to query person exists: %w", err)
+		}
+		if exists {
+			return storage.ErrEditConflict
+		}
+		return storage.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetMovieCredits returns the credits of a movie in billing order.
+func (s Storage) GetMovieCredits(ctx context.Context, movieID int64) ([]storage.Credit, error) {
+	if _, err := s.GetMovie(ctx, movieID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT c.id, c.movie_id, c.person_id, c.role, c.character, c.billing_order, p.name
+		FROM movie_credits c
+		JOIN people p ON p.id = c.person_id
+		WHERE c.movie_id = $1
+		ORDER BY c.billing_order ASC, c.id ASC`
+
+	rows, err := s.db.Query(ctx, query, movieID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query get movie credits: %w", err)
+	}
+	credits, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storage.Credit, error) {
+		var credit storage.Credit
+		err := row.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+			&credit.PersonName,
+		)
+		return credit, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get movie credits: %w", err)
+	}
+
+	return credits, nil
+}
+
+// GetFilmography returns the credits of a person, newest movies first.
+// Movies in the trash are left out.
+func (s Storage) GetFilmography(ctx context.Context, personID int64) ([]storage.Credit, error) {
+	if _, err := s.GetPerson(ctx, personID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT c.id, c.movie_id, c.person_id, c.role, c.character, c.billing_order, m.title, m.year
+		FROM movie_credits c
+		JOIN movies m ON m.id = c.movie_id
+		WHERE c.person_id = $1 AND m.deleted_at IS NULL
+		ORDER BY m.year DESC, m.id ASC, c.billing_order ASC`
+
+	rows, err := s.db.Query(ctx, query, personID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query get filmography: %w", err)
+	}
+	credits, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storage.Credit, error) {
+		var credit storage.Credit
+		err := row.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+			&credit.MovieTitle,
+			&credit.MovieYear,
+		)
+		return credit, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filmography: %w", err)
+	}
+
+	return credits, nil
+}
+
+// CreateMovieCredit adds a credit. It fails with ErrRecordNotFound when the
+// movie or the person does not exist.
+func (s Storage) CreateMovieCredit(ctx context.Context, credit *storage.Credit) error {
+	query := `
+		INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+		SELECT @movie_id, p.id, @role, @character, @billing_order
+		FROM movies m, people p
+		WHERE m.id = @movie_id AND m.deleted_at IS NULL AND p.id = @person_id
+		RETURNING id`
+
+	args := pgx.NamedArgs{
+		"movie_id":      credit.MovieID,
+		"person_id":     credit.PersonID,
+		"role":          credit.Role,
+		"character":     credit.Character,
+		"billing_order": credit.BillingOrder,
+	}
+
+	err := s.db.QueryRow(ctx, query, args).Scan(&credit.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return storage.ErrRecordNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+			return storage.ErrDuplicateCredit
+		default:
+			return fmt.Errorf("failed to query create movie credit: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s Storage) DeleteMovieCredit(ctx context.Context, movieID, creditID int64) error {
+	result, err := s.db.Exec(ctx, "DELETE FROM movie_credits WHERE id = $1 AND movie_id = $2", creditID, movieID)
+	if err != nil {
+		return fmt.Errorf("failed to query delete movie credit: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return storage.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// RateMovie stores the user's rating of the movie, replacing an earlier one,
+// and recomputes the aggregate on the movie in the same transaction.
+func (s Storage) RateMovie(ctx context.Context, rating *storage.Rating) (storage.RatingSummary, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return storage.RatingSummary{}, fmt.Errorf("failed to begin rating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the movie first so concurrent ratings recompute the aggregate one
+	// after another.
+	if err := lockMovie(ctx, tx, rating.MovieID); err != nil {
+		return storage.RatingSummary{}, err
+	}
+
+	query := `
+		INSERT INTO movie_ratings (movie_id, user_id, rating)
+		VALUES (@movie_id, @user_id, @rating)
+		ON CONFLICT (movie_id, user_id) DO UPDATE
+		SET rating = EXCLUDED.rating, updated_at = NOW()
+		RETURNING updated_at`
+
+	args := pgx.NamedArgs{
+		"movie_id": rating.MovieID,
+		"user_id":  rating.UserID,
+		"rating":   rating.Rating,
+	}
+
+	err = tx.QueryRow(ctx, query, args).Scan(&rating.UpdatedAt)
+	if err != nil {
+		return storage.RatingSummary{}, fmt.Errorf("failed to query rate movie: %w", err)
+	}
+
+	summary, err := updateRatingSummary(ctx, tx, rating.MovieID)
+	if err != nil {
+		return storage.RatingSummary{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return storage.RatingSummary{}, fmt.Errorf("failed to commit rating: %w", err)
+	}
+
+	return summary, nil
+}
+
+func (s Storage) DeleteMovieRating(ctx context.Context, movieID, userID int64) (storage.RatingSummary, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return storage.RatingSummary{}, fmt.Errorf("failed to begin rating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockMovie(ctx, tx, movieID); err != nil {
+		return storage.RatingSummary{}, err
+	}
+
+	result, err := tx.Exec(ctx, "DELETE FROM movie_ratings WHERE movie_id = $1 AND user_id = $2", movieID, userID)
+	if err != nil {
+		return storage.RatingSummary{}, fmt.Errorf("failed to query delete movie rating: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return storage.RatingSummary{}, storage.ErrRecordNotFound
+	}
+
+	summary, err := updateRatingSummary(ctx, tx, movieID)
+	if err != nil {
+		return storage.RatingSummary{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return storage.RatingSummary{}, fmt.Errorf("failed to commit rating: %w", err)
+	}
+
+	return summary, nil
+}
+
+func lockMovie(ctx context.Context, tx pgx.Tx, id int64) error {
+	var locked int64
+	err := tx.QueryRow(ctx, "SELECT id FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&locked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrRecordNotFound
+		}
+		return fmt.Errorf("failed to query lock movie: %w", err)
+	}
+	return nil
+}
+
+func updateRatingSummary(ctx context.Context, q querier, movieID int64) (storage.RatingSummary, error) {
+	query := `
+		UPDATE movies
+		SET average_rating = r.average, ratings_count = r.count
+		FROM (
+			SELECT coalesce(round(avg(rating), 2), 0) AS average, count(*) AS count
+			FROM movie_ratings
+			WHERE movie_id = $1
+		) r
+		WHERE id = $1
+		RETURNING average_rating, ratings_count`
+
+	var summary storage.RatingSummary
+	err := q.QueryRow(ctx, query, movieID).Scan(&summary.AverageRating, &summary.RatingsCount)
+	if err != nil {
+		return storage.RatingSummary{}, fmt.Errorf("failed to query update rating summary: %w", err)
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CreateReview adds a pending review. It fails with ErrRecordNotFound when
+// the movie does not exist and with ErrDuplicateReview when the user has
+// already reviewed it.
+func (s Storage) CreateReview(ctx context.Context, review *storage.Review) error {
+	query := `
+		INSERT INTO reviews (movie_id, user_id, title, body)
+		SELECT id, @user_id, @title, @body
+		FROM movies
+		WHERE id = @movie_id AND deleted_at IS NULL
+		RETURNING id, status, created_at, updated_at, version`
+
+	args := pgx.NamedArgs{
+		"movie_id": review.MovieID,
+		"user_id":  review.UserID,
+		"title":    review.Title,
+		"body":     review.Body,
+	}
+
+	err := s.db.QueryRow(ctx, query, args).
+		Scan(&review.ID, &review.Status, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return storage.ErrRecordNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+			return storage.ErrDuplicateReview
+		default:
+			return fmt.Errorf("failed to query create review: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s Storage) GetReview(ctx context.Context, id int64) (*storage.Review, error) {
+	if id < 1 {
+		return nil, storage.ErrRecordNotFound
+	}
+	query := `
+		SELECT r.id, r.movie_id, r.user_id, r.title, r.body, r.status, r.moderated_by,
+			r.created_at, r.updated_at, r.version
+		FROM reviews r
+		JOIN movies m ON m.id = r.movie_id
+		WHERE r.id = $1 AND m.deleted_at IS NULL`
+
+	rows, err := s.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query get review: %w", err)
+	}
+	review, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[storage.Review])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get review: %w", err)
+	}
+
+	return &review, nil
+}
+
+func (s Storage) GetReviews(
+	ctx context.Context,
+	reviewQuery storage.ReviewQuery,
+	filters storage.Filters,
+) (
+	[]*storage.Review,
+	storage.Metadata,
+	error,
+) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), r.id, r.movie_id, r.user_id, r.title, r.body, r.status, r.moderated_by,
+			r.created_at, r.updated_at, r.version
+		FROM reviews r
+		JOIN movies m ON m.id = r.movie_id
+		WHERE m.deleted_at IS NULL
+			AND (@movie_id::bigint = 0 OR r.movie_id = @movie_id)
+			AND (r.status = ANY(@statuses::text[]) OR r.user_id = @author_id)
+		ORDER BY r.%s %s, r.id ASC
+		LIMIT @limit OFFSET @offset`,
+		sortColumn(filters), sortDirection(filters),
+	)
+
+	statuses := reviewQuery.Statuses
+	if statuses == nil {
+		statuses = []string{}
+	}
+	args := pgx.NamedArgs{
+		"movie_id":  reviewQuery.MovieID,
+		"statuses":  statuses,
+		"author_id": reviewQuery.AuthorID,
+		"limit":     filters.PageSize,
+		"offset":    filters.Offset(),
+	}
+
+	rows, err := s.db.Query(ctx, query, args)
+	if err != nil {
+		return nil, storage.Metadata{}, fmt.Errorf("failed to query get reviews: %w", err)
+	}
+	defer rows.Close()
+
+	reviews := []*storage.Review{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var review storage.Review
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.MovieID,
+			&review.UserID,
+			&review.Title,
+			&review.Body,
+			&review.Status,
+			&review.ModeratedBy,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, storage.Metadata{}, fmt.Errorf("failed to scan review: %w", err)
+		}
+		reviews = append(reviews, &review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, storage.Metadata{}, fmt.Errorf("failed to get reviews: %w", err)
+	}
+
+	return reviews, storage.NewMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// UpdateReview saves the review with its status and moderator as given, so
+// callers decide whether an edit sends it back to moderation.
+func (s Storage) UpdateReview(ctx context.Context, review *storage.Review) error {
+	query := `
+		UPDATE reviews
+		SET title = @title, body = @body, status = @status, moderated_by = @moderated_by,
+			updated_at = NOW(), version = version + 1
+		WHERE id = @id AND version = @version
+		RETURNING updated_at, version`
+
+	args := pgx.NamedArgs{
+		"id":           review.ID,
+		"title":        review.Title,
+		"body":         review.Body,
+		"status":       review.Status,
+		"moderated_by": review.ModeratedBy,
+		"version":      review.Version,
+	}
+
+	err := s.db.QueryRow(ctx, query, args).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrEditConflict
+		}
+		return fmt.Errorf("failed to query update review: %w", err)
+	}
+
+	return nil
+}
+
+func (s Storage) DeleteReview(ctx context.Context, id int64) error {
+	result, err := s.db.Exec(ctx, "DELETE FROM reviews WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to query delete review: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return storage.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetMovieRevisions returns every recorded version of the movie, newest
+// first.
+func (s Storage) GetMovieRevisions(ctx context.Context, movieID int64) ([]storage.Revision, error) {
+	if movieID < 1 {
+		return nil, storage.ErrRecordNotFound
+	}
+	query := `
+		SELECT movie_id, version, title, year, runtime, genres, user_id, created_at
+		FROM movie_revisions
+		WHERE movie_id = $1
+		ORDER BY version DESC`
+
+	rows, err := s.db.Query(ctx, query, movieID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query get movie revisions: %w", err)
+	}
+	revisions, err := pgx.CollectRows(rows, pgx.RowToStructByName[storage.Revision])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get movie revisions: %w", err)
+	}
+	if len(revisions) == 0 {
+		return nil, storage.ErrRecordNotFound
+	}
+
+	return revisions, nil
+}
+
+func (s Storage) GetMovieRevision(ctx context.Context, movieID int64, version int32) (*storage.Revision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, storage.ErrRecordNotFound
+	}
+	query := `
+		SELECT movie_id, version, title, year, runtime, genres, user_id, created_at
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2`
+
+	rows, err := s.db.Query(ctx, query, movieID, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query get movie revision: %w", err)
+	}
+	revision, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[storage.Revision])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get movie revision: %w", err)
+	}
+
+	return &revision, nil
+}
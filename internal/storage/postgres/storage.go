@@ -3,10 +3,18 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const maxConnectBackoff = 30 * time.Second
+
 type Storage struct {
 	db       *pgxpool.Pool
 	host     string
@@ -14,26 +22,58 @@ type Storage struct {
 	user     string
 	password string
 	name     string
+	opts     Options
+}
+
+// querier is what pool and transaction have in common, so helpers can run
+// either inside or outside a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type Options struct {
+	MaxOpenConns      int
+	MaxIdleTime       time.Duration
+	SSLMode           string
+	SSLRootCert       string
+	StatementTimeout  time.Duration
+	ApplicationName   string
+	HealthCheckPeriod time.Duration
+	ConnectRetries    int
+	ConnectBackoff    time.Duration
 }
 
-func NewStorage(host, port, user, password, name string) Storage {
+func NewStorage(host, port, user, password, name string, opts Options) Storage {
 	return Storage{
 		host:     host,
 		port:     port,
 		user:     user,
 		password: password,
 		name:     name,
+		opts:     opts,
 	}
 }
 
 func (s *Storage) Connect(ctx context.Context) error {
-	var err error
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", s.user, s.password, s.host, s.port, s.name)
-	s.db, err = pgxpool.New(ctx, dsn)
+	config, err := s.poolConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return fmt.Errorf("failed to connect to postgres: %w", err)
 	}
 
+	err = s.ping(ctx, db)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	s.db = db
+
 	return nil
 }
 
@@ -45,3 +85,70 @@ func (s *Storage) Close(_ context.Context) error {
 
 	return nil
 }
+
+func (s *Storage) poolConfig() (*pgxpool.Config, error) {
+	sslMode := s.opts.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	params := url.Values{}
+	params.Set("sslmode", sslMode)
+	if s.opts.SSLRootCert != "" {
+		params.Set("sslrootcert", s.opts.SSLRootCert)
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(s.user, s.password),
+		Host:     net.JoinHostPort(s.host, s.port),
+		Path:     "/" + s.name,
+		RawQuery: params.Encode(),
+	}
+
+	config, err := pgxpool.ParseConfig(dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postgres config: %w", err)
+	}
+
+	if s.opts.MaxOpenConns > 0 {
+		config.MaxConns = int32(s.opts.MaxOpenConns)
+	}
+	if s.opts.MaxIdleTime > 0 {
+		config.MaxConnIdleTime = s.opts.MaxIdleTime
+	}
+	if s.opts.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = s.opts.HealthCheckPeriod
+	}
+	if s.opts.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(s.opts.StatementTimeout.Milliseconds(), 10)
+	}
+	if s.opts.ApplicationName != "" {
+		config.ConnConfig.RuntimeParams["application_name"] = s.opts.ApplicationName
+	}
+
+	return config, nil
+}
+
+func (s *Storage) ping(ctx context.Context, db *pgxpool.Pool) error {
+	backoff := s.opts.ConnectBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := db.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt > s.opts.ConnectRetries {
+			return fmt.Errorf("failed to ping postgres after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to ping postgres: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetDeletedMovies lists the trash, most recently deleted first.
+func (s Storage) GetDeletedMovies(
+	ctx context.Context,
+	filters storage.Filters,
+) (
+	[]*storage.DeletedMovie,
+	storage.Metadata,
+	error,
+) {
+	query := `
+		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, average_rating, ratings_count, deleted_at
+		FROM movies
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id DESC
+		LIMIT @limit OFFSET @offset`
+
+	args := pgx.NamedArgs{
+		"limit":  filters.PageSize,
+		"offset": filters.Offset(),
+	}
+
+	rows, err := s.db.Query(ctx, query, args)
+	if err != nil {
+		return nil, storage.Metadata{}, fmt.Errorf("failed to query get deleted movies: %w", err)
+	}
+	defer rows.Close()
+
+	movies := []*storage.DeletedMovie{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var movie storage.DeletedMovie
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			&movie.Genres,
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingsCount,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, storage.Metadata{}, fmt.Errorf("failed to scan deleted movie: %w", err)
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, storage.Metadata{}, fmt.Errorf("failed to get deleted movies: %w", err)
+	}
+
+	return movies, storage.NewMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// RestoreMovie takes the movie out of the trash. It comes back as it was,
+// with the same version, so its ETag and revisions still hold.
+func (s Storage) RestoreMovie(ctx context.Context, id int64) (*storage.Movie, error) {
+	if id < 1 {
+		return nil, storage.ErrRecordNotFound
+	}
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, created_at, title, year, runtime, genres, version, average_rating, ratings_count`
+
+	rows, err := s.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query restore movie: %w", err)
+	}
+	movie, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[storage.Movie])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to restore movie: %w", err)
+	}
+
+	return &movie, nil
+}
+
+// PurgeMovie permanently removes a movie that is in the trash, together with
+// its revisions.
+func (s Storage) PurgeMovie(ctx context.Context, id int64) error {
+	if id < 1 {
+		return storage.ErrRecordNotFound
+	}
+
+	result, err := s.db.Exec(ctx, "DELETE FROM movies WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("failed to query purge movie: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return storage.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeDeletedMovies permanently removes movies deleted before the given
+// time and reports how many were removed.
+func (s Storage) PurgeDeletedMovies(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.Exec(ctx, "DELETE FROM movies WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query purge deleted movies: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,17 @@
+package storage
+
+import "time"
+
+type Rating struct {
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	Rating    int32     `json:"rating" validate:"required,min=1,max=10"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RatingSummary is the aggregate kept on a movie, recomputed whenever one of
+// its ratings changes.
+type RatingSummary struct {
+	AverageRating float64 `json:"average_rating"`
+	RatingsCount  int32   `json:"ratings_count"`
+}
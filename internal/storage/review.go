@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrDuplicateReview = errors.New("duplicate review")
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// ReviewStatuses lists every moderation state a review can be in.
+func ReviewStatuses() []string {
+	return []string{ReviewPending, ReviewApproved, ReviewRejected}
+}
+
+type Review struct {
+	ID          int64     `db:"id" json:"id"`
+	MovieID     int64     `db:"movie_id" json:"movie_id"`
+	UserID      int64     `db:"user_id" json:"user_id"`
+	Title       string    `db:"title" json:"title" validate:"required,lt=200"`
+	Body        string    `db:"body" json:"body" validate:"required,max=10000"`
+	Status      string    `db:"status" json:"status" validate:"oneof=pending approved rejected"`
+	ModeratedBy *int64    `db:"moderated_by" json:"moderated_by,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+	Version     int32     `db:"version" json:"version"`
+}
+
+// ReviewQuery selects reviews in any of Statuses, plus every review written
+// by AuthorID so users always see their own. A zero MovieID spans all movies.
+type ReviewQuery struct {
+	MovieID  int64
+	Statuses []string
+	AuthorID int64
+}
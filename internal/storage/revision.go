@@ -0,0 +1,16 @@
+package storage
+
+import "time"
+
+// Revision is a snapshot of a movie as it was at Version. UserID is nil for
+// changes made outside of an authenticated request, such as imports.
+type Revision struct {
+	MovieID   int64     `db:"movie_id" json:"movie_id"`
+	Version   int32     `db:"version" json:"version"`
+	Title     string    `db:"title" json:"title"`
+	Year      int32     `db:"year" json:"year"`
+	Runtime   Runtime   `db:"runtime" json:"runtime"`
+	Genres    []string  `db:"genres" json:"genres"`
+	UserID    *int64    `db:"user_id" json:"user_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +24,62 @@ type Movie struct {
 	Runtime   Runtime   `db:"runtime" json:"runtime" validate:"required,gt=0"`
 	Genres    []string  `db:"genres" json:"genres" validate:"required,min=1,max=5"`
 	Version   int32     `db:"version" json:"version"`
+
+	AverageRating float64 `db:"average_rating" json:"average_rating"`
+	RatingsCount  int32   `db:"ratings_count" json:"ratings_count"`
+
+	Rank      float32 `db:"-" json:"-"`
+	Highlight string  `db:"-" json:"highlight,omitempty"`
+}
+
+type Suggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type Facets struct {
+	Genres  []FacetCount `json:"genres,omitempty"`
+	Year    []FacetCount `json:"year,omitempty"`
+	Runtime []FacetCount `json:"runtime,omitempty"`
+}
+
+var runtimeBuckets = []int32{90, 120, 150}
+
+// RuntimeBuckets returns the upper bounds, exclusive, of every runtime facet
+// bucket except the last one, which is open-ended.
+func RuntimeBuckets() []int32 {
+	return slices.Clone(runtimeBuckets)
+}
+
+// RuntimeBucket returns the index of the runtime facet bucket r falls into,
+// the same way width_bucket does over RuntimeBuckets.
+func RuntimeBucket(r Runtime) int {
+	for i, bound := range runtimeBuckets {
+		if int32(r) < bound {
+			return i
+		}
+	}
+	return len(runtimeBuckets)
+}
+
+func RuntimeBucketLabel(bucket int) string {
+	switch {
+	case bucket <= 0:
+		return fmt.Sprintf("<%d", runtimeBuckets[0])
+	case bucket >= len(runtimeBuckets):
+		return fmt.Sprintf("%d+", runtimeBuckets[len(runtimeBuckets)-1])
+	default:
+		return fmt.Sprintf("%d-%d", runtimeBuckets[bucket-1], runtimeBuckets[bucket]-1)
+	}
+}
+
+func DecadeLabel(year int32) string {
+	return fmt.Sprintf("%ds", year/10*10)
 }
 
 type Filters struct {
@@ -30,6 +87,18 @@ type Filters struct {
 	PageSize     int    `validate:"gt=0,max=100"`
 	Sort         string `validate:"safesort"`
 	SortSafelist []string
+	Cursor       *Cursor
+	IncludeTotal bool
+	Fuzzy        bool
+
+	YearFrom       int32  `validate:"omitempty,min=1888,max=2100"`
+	YearTo         int32  `validate:"omitempty,min=1888,max=2100,gtefield=YearFrom"`
+	RuntimeMin     int32  `validate:"omitempty,gt=0"`
+	RuntimeMax     int32  `validate:"omitempty,gt=0,gtefield=RuntimeMin"`
+	GenresMatch    string `validate:"oneof=all any"`
+	ExcludedGenres []string
+	PersonID       int64   `validate:"omitempty,gt=0"`
+	MinRating      float64 `validate:"omitempty,min=1,max=10"`
 }
 
 func (f Filters) Offset() int {
@@ -37,11 +106,14 @@ func (f Filters) Offset() int {
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+	Fuzzy        bool   `json:"fuzzy,omitempty"`
 }
 
 func NewMetadata(totalRecords, page, pageSize int) Metadata {
@@ -59,9 +131,12 @@ func NewMetadata(totalRecords, page, pageSize int) Metadata {
 
 type Runtime int32
 
+func (r Runtime) String() string {
+	return fmt.Sprintf("%d mins", r)
+}
+
 func (r Runtime) MarshalJSON() ([]byte, error) {
-	jsonValue := fmt.Sprintf("%d mins", r)
-	quotedJSONValue := strconv.Quote(jsonValue)
+	quotedJSONValue := strconv.Quote(r.String())
 	return []byte(quotedJSONValue), nil
 }
 
@@ -70,15 +145,21 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 	if err != nil {
 		return ErrInvalidRuntimeFormat
 	}
-	parts := strings.Split(unquotedJSONValue, " ")
+
+	*r, err = ParseRuntime(unquotedJSONValue)
+	return err
+}
+
+// ParseRuntime parses the "<n> mins" form produced by Runtime.String.
+func ParseRuntime(s string) (Runtime, error) {
+	parts := strings.Split(s, " ")
 	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 	i, err := strconv.ParseInt(parts[0], 10, 32)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 
-	*r = Runtime(i)
-	return nil
+	return Runtime(i), nil
 }
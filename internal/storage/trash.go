@@ -0,0 +1,9 @@
+package storage
+
+import "time"
+
+// DeletedMovie is a movie in the trash, kept until it is restored or purged.
+type DeletedMovie struct {
+	Movie
+	DeletedAt time.Time `db:"deleted_at" json:"deleted_at"`
+}
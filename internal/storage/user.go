@@ -1,6 +1,9 @@
 package storage
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 var AnonymousUser = &User{}
 
@@ -24,6 +27,36 @@ func (u *User) IncludePermission(code string) bool {
 }
 
 var (
-	ErrInvalidToken  = errors.New("invalid token")
-	ErrInternalError = errors.New("internal error")
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrInternalError   = errors.New("internal error")
+	ErrAuthUnavailable = errors.New("auth service unavailable")
 )
+
+type userContextKey struct{}
+
+// ContextWithUser returns a copy of ctx carrying the user making the
+// request, so storage can attribute the changes it records.
+func ContextWithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext returns the user stored by ContextWithUser, or
+// AnonymousUser if there is none.
+func UserFromContext(ctx context.Context) *User {
+	user, ok := ctx.Value(userContextKey{}).(*User)
+	if !ok || user == nil {
+		return AnonymousUser
+	}
+	return user
+}
+
+// ActingUserID returns the ID of the user in ctx, or nil for an anonymous
+// user.
+func ActingUserID(ctx context.Context) *int64 {
+	user := UserFromContext(ctx)
+	if user.IsAnonymous() {
+		return nil
+	}
+	id := user.ID
+	return &id
+}
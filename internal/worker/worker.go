@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/AndreyChufelin/movies-api/internal/logger"
+)
+
+// Every runs fn every interval until ctx is done. Failures are logged and
+// the job carries on with the next tick.
+func Every(ctx context.Context, log *logger.Logger, name string, interval time.Duration, fn func(context.Context) error) {
+	jobLog := log.With("job", name)
+	if interval <= 0 {
+		jobLog.Warn("job disabled, interval must be positive")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			jobLog.Info("stopping job")
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil {
+				jobLog.Error("job failed", "error", err)
+			}
+		}
+	}
+}
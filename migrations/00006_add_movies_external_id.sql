@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS external_id text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_id_idx ON movies (external_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS movies_external_id_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS external_id;
+
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS movie_ratings (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id bigint NOT NULL,
+    rating smallint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (movie_id, user_id)
+);
+ALTER TABLE movie_ratings ADD CONSTRAINT movie_ratings_rating_check CHECK (rating BETWEEN 1 AND 10);
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS average_rating numeric(4, 2) NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS ratings_count integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS movies_average_rating_idx ON movies (average_rating);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS movies_average_rating_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS ratings_count;
+ALTER TABLE movies DROP COLUMN IF EXISTS average_rating;
+
+DROP TABLE IF EXISTS movie_ratings;
+
+-- +goose StatementEnd
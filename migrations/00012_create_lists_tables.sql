@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS lists (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    kind text NOT NULL,
+    name text NOT NULL,
+    public boolean NOT NULL DEFAULT false,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE lists ADD CONSTRAINT lists_kind_check CHECK (kind IN ('watchlist', 'favorites', 'custom'));
+
+CREATE INDEX IF NOT EXISTS lists_user_id_idx ON lists (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS lists_user_id_kind_idx ON lists (user_id, kind) WHERE kind <> 'custom';
+
+CREATE TABLE IF NOT EXISTS list_items (
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_items_list_id_position_idx ON list_items (list_id, position);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS list_items;
+
+DROP TABLE IF EXISTS lists;
+
+-- +goose StatementEnd
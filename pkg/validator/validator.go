@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"unicode"
 
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
@@ -19,6 +21,9 @@ type Validator struct {
 type ValidationError struct {
 	Field   string
 	Message string
+	// Pointer is the JSON pointer to the invalid value in the request, built
+	// from json or query struct tags.
+	Pointer string `json:"-"`
 }
 
 type ValidationErrors struct {
@@ -40,10 +45,12 @@ func (cv *Validator) Validate(i interface{}) error {
 		if ok := errors.As(err, &verr); !ok {
 			panic("error must be of type ValidationErrors")
 		}
+		root := reflect.TypeOf(i)
 		for _, err := range verr {
 			errs = append(errs, ValidationError{
 				Field:   err.Field(),
 				Message: err.Translate(cv.trans),
+				Pointer: jsonPointer(root, err.StructNamespace()),
 			})
 		}
 
@@ -95,3 +102,68 @@ func sortInSafelist(fl validator.FieldLevel) bool {
 	}
 	return false
 }
+
+// jsonPointer maps a struct namespace such as "Movie.Genres[1]" to the path
+// clients know it by, "/genres/1". Embedded structs add no path segment.
+func jsonPointer(root reflect.Type, namespace string) string {
+	segments := strings.Split(namespace, ".")[1:]
+
+	var pointer strings.Builder
+	current := root
+	for _, segment := range segments {
+		name, index, _ := strings.Cut(segment, "[")
+		index = strings.TrimSuffix(index, "]")
+
+		for current != nil && current.Kind() == reflect.Pointer {
+			current = current.Elem()
+		}
+		var field reflect.StructField
+		found := false
+		if current != nil && current.Kind() == reflect.Struct {
+			field, found = current.FieldByName(name)
+		}
+		if !found {
+			pointer.WriteString("/" + toSnakeCase(name))
+			current = nil
+		} else {
+			if !field.Anonymous {
+				pointer.WriteString("/" + fieldName(field))
+			}
+			current = field.Type
+		}
+
+		if index != "" {
+			pointer.WriteString("/" + index)
+			if current != nil && (current.Kind() == reflect.Slice || current.Kind() == reflect.Array) {
+				current = current.Elem()
+			}
+		}
+	}
+
+	return pointer.String()
+}
+
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "query", "param"} {
+		name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return toSnakeCase(field.Name)
+}
+
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}